@@ -0,0 +1,217 @@
+package cards
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/math/fixed"
+)
+
+// Version is bumped whenever the card design changes, so cached cards are re-rendered
+const Version = 1
+
+// Card size, the common aspect for link previews
+const (
+	Width  = 1200
+	Height = 630
+)
+
+const padding = 64
+
+// Brand colors, matching the web app's Tailwind theme
+var (
+	colorBackground = color.RGBA{0x0f, 0x17, 0x2a, 0xff} // dark-900
+	colorPanel      = color.RGBA{0x1e, 0x29, 0x3b, 0xff} // dark-800
+	colorAccent     = color.RGBA{0x63, 0x66, 0xf1, 0xff} // brand-500
+	colorBrand      = color.RGBA{0x81, 0x8c, 0xf8, 0xff} // brand-400
+	colorQuestion   = color.RGBA{0xcb, 0xd5, 0xe1, 0xff} // dark-300
+	colorAnswer     = color.RGBA{0xf8, 0xfa, 0xfc, 0xff} // dark-50
+	colorMuted      = color.RGBA{0x94, 0xa3, 0xb8, 0xff} // dark-400
+)
+
+// Card is what goes on an answer card. The tell's sender is deliberately not part of it.
+type Card struct {
+	Question string
+	Answer   string
+	FullName string
+	Username string
+	SiteName string
+}
+
+// Render draws the card as a PNG
+func Render(card Card) ([]byte, error) {
+	img := imaging.New(Width, Height, colorBackground)
+
+	nameFace, err := newFaceSet(36, true)
+	if err != nil {
+		return nil, err
+	}
+	defer nameFace.close()
+	smallFace, err := newFaceSet(26, false)
+	if err != nil {
+		return nil, err
+	}
+	defer smallFace.close()
+	questionFace, err := newFaceSet(32, false)
+	if err != nil {
+		return nil, err
+	}
+	defer questionFace.close()
+	answerFace, err := newFaceSet(40, true)
+	if err != nil {
+		return nil, err
+	}
+	defer answerFace.close()
+
+	// Accent bar down the left edge
+	draw.Draw(img, image.Rect(0, 0, 12, Height), image.NewUniform(colorAccent), image.Point{}, draw.Src)
+
+	inner := Width - 2*padding
+	y := padding
+
+	// Header: receiver name and handle
+	name := card.FullName
+	if name == "" {
+		name = card.Username
+	}
+	y += fixedInt(nameFace.lineHeight())
+	drawLine(img, nameFace, colorAnswer, padding, y, inner, singleLine(nameFace, name, inner))
+	y += fixedInt(smallFace.lineHeight())
+	drawLine(img, smallFace, colorMuted, padding, y, inner, singleLine(smallFace, "@"+card.Username, inner))
+	y += 32
+
+	// Question in a panel
+	questionLines := wrap(questionFace, card.Question, inner-2*32, 3)
+	panelHeight := len(questionLines)*fixedInt(questionFace.lineHeight()) + 2*28
+	fillRoundedRect(img, image.Rect(padding, y, Width-padding, y+panelHeight), 20, colorPanel)
+	lineY := y + 28
+	for _, line := range questionLines {
+		lineY += fixedInt(questionFace.lineHeight())
+		drawLine(img, questionFace, colorQuestion, padding+32, lineY-8, inner-2*32, line)
+	}
+	y += panelHeight + 24
+
+	// Answer fills what is left above the footer
+	footerTop := Height - padding - fixedInt(smallFace.lineHeight())
+	maxAnswerLines := (footerTop - y - 16) / fixedInt(answerFace.lineHeight())
+	if maxAnswerLines < 1 {
+		maxAnswerLines = 1
+	}
+	for _, line := range wrap(answerFace, card.Answer, inner, maxAnswerLines) {
+		y += fixedInt(answerFace.lineHeight())
+		drawLine(img, answerFace, colorAnswer, padding, y, inner, line)
+	}
+
+	// Footer: site name
+	drawLine(img, smallFace, colorBrand, padding, Height-padding, inner, singleLine(smallFace, card.SiteName, inner))
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.PNG); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// line is one wrapped line in logical order, with its paragraph direction
+type line struct {
+	text string
+	rtl  bool
+}
+
+// wrap shapes text and breaks it into at most maxLines lines of width,
+// ending with an ellipsis when it doesn't fit
+func wrap(face *faceSet, text string, width, maxLines int) []line {
+	limit := fixed.I(width)
+	var lines []line
+
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n") {
+		rtl := IsRTL(paragraph)
+		words := strings.Fields(Shape(paragraph))
+		if len(words) == 0 {
+			continue
+		}
+
+		current := ""
+		for _, word := range words {
+			candidate := word
+			if current != "" {
+				candidate = current + " " + word
+			}
+			if face.measure(candidate) <= limit || current == "" {
+				current = candidate
+				continue
+			}
+			lines = append(lines, line{text: current, rtl: rtl})
+			current = word
+		}
+		lines = append(lines, line{text: current, rtl: rtl})
+	}
+
+	if len(lines) <= maxLines {
+		for i := range lines {
+			lines[i].text = fitWidth(face, lines[i].text, limit)
+		}
+		return lines
+	}
+
+	lines = lines[:maxLines]
+	last := &lines[maxLines-1]
+	last.text = fitWidth(face, last.text+"…", limit)
+	return lines
+}
+
+// fitWidth trims runes off the end of a too-long line, keeping an ellipsis
+func fitWidth(face *faceSet, text string, limit fixed.Int26_6) string {
+	if face.measure(text) <= limit {
+		return text
+	}
+	runes := []rune(strings.TrimSuffix(text, "…"))
+	for len(runes) > 0 && face.measure(string(runes)+"…") > limit {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// singleLine shapes a short label and cuts it to width
+func singleLine(face *faceSet, text string, width int) line {
+	return line{text: fitWidth(face, Shape(text), fixed.I(width)), rtl: IsRTL(text)}
+}
+
+// drawLine draws one line with its baseline at y, right-aligned for right-to-left text
+func drawLine(img draw.Image, face *faceSet, c color.Color, x, y, width int, l line) {
+	visual := Visual(l.text, l.rtl)
+	if l.rtl {
+		x += width - fixedInt(face.measure(visual))
+	}
+	face.draw(img, image.NewUniform(c), fixed.P(x, y), visual)
+}
+
+// fillRoundedRect fills r with rounded corners of the given radius
+func fillRoundedRect(img draw.Image, r image.Rectangle, radius int, c color.Color) {
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			dx, dy := 0, 0
+			if px < r.Min.X+radius {
+				dx = r.Min.X + radius - px
+			} else if px >= r.Max.X-radius {
+				dx = px - (r.Max.X - radius - 1)
+			}
+			if py < r.Min.Y+radius {
+				dy = r.Min.Y + radius - py
+			} else if py >= r.Max.Y-radius {
+				dy = py - (r.Max.Y - radius - 1)
+			}
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(px, py, c)
+			}
+		}
+	}
+}
+
+func fixedInt(v fixed.Int26_6) int {
+	return v.Ceil()
+}
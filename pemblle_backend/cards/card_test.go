@@ -0,0 +1,63 @@
+package cards
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+var rtlSamples = []string{
+	"مرحبا، كيف حالك اليوم؟ لا أعرف ٢٠٢٦",                    // Arabic, with lam-alef and Arabic-Indic digits
+	"سوپاس بۆ وەڵامەکەت، ئەم پرسیارە زۆر باشە. ڕێگا ڤیان ژن", // Sorani Kurdish
+}
+
+// TestArabicGlyphs checks that every shaped Arabic and Kurdish character has
+// a glyph in the fonts, instead of being drawn as a missing-glyph box
+func TestArabicGlyphs(t *testing.T) {
+	for _, bold := range []bool{false, true} {
+		set, err := newFaceSet(32, bold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer set.close()
+
+		for _, text := range rtlSamples {
+			for _, r := range Shape(text) {
+				if r == ' ' {
+					continue
+				}
+				found := false
+				for _, f := range set.fonts {
+					if index, err := f.GlyphIndex(&set.buf, r); err == nil && index != 0 {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("no glyph for %q (U+%04X), bold %v", r, r, bold)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderArabic(t *testing.T) {
+	data, err := Render(Card{
+		Question: rtlSamples[0],
+		Answer:   rtlSamples[1],
+		FullName: "هاوڕێ",
+		Username: "hawre",
+		SiteName: "PemBlle",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != Width || size.Y != Height {
+		t.Errorf("card is %v, want %dx%d", size, Width, Height)
+	}
+}
@@ -0,0 +1,136 @@
+package cards
+
+import (
+	"embed"
+	"image"
+	"image/draw"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+//go:embed fonts
+var bundledFonts embed.FS
+
+var (
+	loadFontsOnce sync.Once
+	regularFonts  []*sfnt.Font
+	boldFonts     []*sfnt.Font
+)
+
+// loadFonts parses the Go fonts followed by the bundled fallback fonts
+func loadFonts() {
+	regular, _ := opentype.Parse(goregular.TTF)
+	bold, _ := opentype.Parse(gobold.TTF)
+	regularFonts = []*sfnt.Font{regular}
+	boldFonts = []*sfnt.Font{bold}
+
+	fs.WalkDir(bundledFonts, "fonts", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".ttf" && ext != ".otf" {
+			return nil
+		}
+
+		data, err := bundledFonts.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := opentype.Parse(data)
+		if err != nil {
+			log.Printf("❌ Could not parse card font %s: %v", name, err)
+			return nil
+		}
+
+		if strings.HasSuffix(strings.ToLower(strings.TrimSuffix(name, path.Ext(name))), "-bold") {
+			boldFonts = append(boldFonts, f)
+		} else {
+			regularFonts = append(regularFonts, f)
+		}
+		return nil
+	})
+}
+
+// faceSet draws text with a chain of fonts, taking each character from the
+// first font that has a glyph for it
+type faceSet struct {
+	fonts []*sfnt.Font
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+func newFaceSet(size float64, bold bool) (*faceSet, error) {
+	loadFontsOnce.Do(loadFonts)
+
+	fonts := regularFonts
+	if bold {
+		fonts = boldFonts
+		// Regular fallbacks still beat missing glyphs
+		fonts = append(fonts[:len(fonts):len(fonts)], regularFonts[1:]...)
+	}
+
+	set := &faceSet{fonts: fonts}
+	for _, f := range fonts {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		set.faces = append(set.faces, face)
+	}
+	return set, nil
+}
+
+// pick returns the face that should draw r
+func (s *faceSet) pick(r rune) font.Face {
+	for i, f := range s.fonts {
+		if index, err := f.GlyphIndex(&s.buf, r); err == nil && index != 0 {
+			return s.faces[i]
+		}
+	}
+	return s.faces[0]
+}
+
+// measure returns the advance width of text
+func (s *faceSet) measure(text string) fixed.Int26_6 {
+	var width fixed.Int26_6
+	for _, r := range text {
+		if advance, ok := s.pick(r).GlyphAdvance(r); ok {
+			width += advance
+		}
+	}
+	return width
+}
+
+// lineHeight is the distance between baselines
+func (s *faceSet) lineHeight() fixed.Int26_6 {
+	return s.faces[0].Metrics().Height
+}
+
+// draw renders text, already in visual order, with its baseline at dot
+func (s *faceSet) draw(dst draw.Image, src image.Image, dot fixed.Point26_6, text string) {
+	for _, r := range text {
+		face := s.pick(r)
+		dr, mask, maskp, advance, ok := face.Glyph(dot, r)
+		if ok {
+			draw.DrawMask(dst, dr, src, image.Point{}, mask, maskp, draw.Over)
+		}
+		dot.X += advance
+	}
+}
+
+func (s *faceSet) close() {
+	for _, face := range s.faces {
+		face.Close()
+	}
+}
@@ -0,0 +1,274 @@
+package cards
+
+import "unicode"
+
+// arabicForms maps an Arabic letter to its presentation forms:
+// isolated, final, initial, medial. Letters with no initial/medial form only
+// join to the letter before them (alef, dal, reh, waw, ...).
+var arabicForms = map[rune][4]rune{
+	'ء': {0xFE80, 0, 0, 0},
+	'آ': {0xFE81, 0xFE82, 0, 0},
+	'أ': {0xFE83, 0xFE84, 0, 0},
+	'ؤ': {0xFE85, 0xFE86, 0, 0},
+	'إ': {0xFE87, 0xFE88, 0, 0},
+	'ئ': {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	'ا': {0xFE8D, 0xFE8E, 0, 0},
+	'ب': {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	'ة': {0xFE93, 0xFE94, 0, 0},
+	'ت': {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	'ث': {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	'ج': {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	'ح': {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	'خ': {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	'د': {0xFEA9, 0xFEAA, 0, 0},
+	'ذ': {0xFEAB, 0xFEAC, 0, 0},
+	'ر': {0xFEAD, 0xFEAE, 0, 0},
+	'ز': {0xFEAF, 0xFEB0, 0, 0},
+	'س': {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	'ش': {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	'ص': {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	'ض': {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	'ط': {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	'ظ': {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	'ع': {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	'غ': {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	'ـ': {0x0640, 0x0640, 0x0640, 0x0640}, // Tatweel
+	'ف': {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	'ق': {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	'ك': {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	'ل': {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	'م': {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	'ن': {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	'ه': {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	'و': {0xFEED, 0xFEEE, 0, 0},
+	'ى': {0xFEEF, 0xFEF0, 0, 0},
+	'ي': {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	// Persian and Kurdish letters
+	'پ': {0xFB56, 0xFB57, 0xFB58, 0xFB59},
+	'چ': {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D},
+	'ژ': {0xFB8A, 0xFB8B, 0, 0},
+	'ڤ': {0xFB6A, 0xFB6B, 0xFB6C, 0xFB6D},
+	'ک': {0xFB8E, 0xFB8F, 0xFB90, 0xFB91},
+	'گ': {0xFB92, 0xFB93, 0xFB94, 0xFB95},
+	'ھ': {0xFBAA, 0xFBAB, 0xFBAC, 0xFBAD},
+	'ۆ': {0xFBD9, 0xFBDA, 0, 0},
+	'ی': {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF},
+}
+
+// Kurdish letters with no presentation forms in Unicode. They keep their
+// base code point but still decide whether their neighbours connect.
+var (
+	dualJoiningBare  = map[rune]bool{'ڵ': true, 'ێ': true}
+	rightJoiningBare = map[rune]bool{'ڕ': true, 'ە': true}
+)
+
+// lamAlef maps the alef that follows a lam to the isolated and final ligature
+var lamAlef = map[rune][2]rune{
+	'آ': {0xFEF5, 0xFEF6},
+	'أ': {0xFEF7, 0xFEF8},
+	'إ': {0xFEF9, 0xFEFA},
+	'ا': {0xFEFB, 0xFEFC},
+}
+
+const (
+	formIsolated = iota
+	formFinal
+	formInitial
+	formMedial
+)
+
+// isTransparent reports whether r is a combining mark (harakat) that sits on
+// a letter without affecting how letters join
+func isTransparent(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
+
+func joinsBefore(r rune) bool {
+	if forms, ok := arabicForms[r]; ok {
+		return forms[formInitial] != 0
+	}
+	return dualJoiningBare[r]
+}
+
+func joinsAfter(r rune) bool {
+	if forms, ok := arabicForms[r]; ok {
+		return forms[formFinal] != 0
+	}
+	return dualJoiningBare[r] || rightJoiningBare[r]
+}
+
+// Shape replaces Arabic-script letters with their contextual presentation
+// forms so they connect when drawn glyph by glyph. Text stays in logical order.
+// Harakat are dropped: without a shaping engine there is no way to place them.
+func Shape(text string) string {
+	runes := []rune(text)
+	out := make([]rune, 0, len(runes))
+
+	neighbour := func(i, step int) rune {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if !isTransparent(runes[j]) {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if isTransparent(r) && unicode.In(r, unicode.Arabic) {
+			continue
+		}
+		if !joinsAfter(r) && !joinsBefore(r) {
+			out = append(out, r)
+			continue
+		}
+
+		prev := neighbour(i, -1)
+		next := neighbour(i, 1)
+		joinPrev := prev != 0 && joinsBefore(prev)
+
+		if r == 'ل' && i+1 < len(runes) {
+			if ligature, ok := lamAlef[runes[i+1]]; ok {
+				if joinPrev {
+					out = append(out, ligature[formFinal])
+				} else {
+					out = append(out, ligature[formIsolated])
+				}
+				i++
+				continue
+			}
+		}
+
+		forms, ok := arabicForms[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+
+		joinNext := next != 0 && joinsBefore(r) && joinsAfter(next)
+
+		form := formIsolated
+		switch {
+		case joinPrev && joinNext:
+			form = formMedial
+		case joinPrev:
+			form = formFinal
+		case joinNext:
+			form = formInitial
+		}
+		if forms[form] == 0 {
+			form = formIsolated
+		}
+		out = append(out, forms[form])
+	}
+
+	return string(out)
+}
+
+// isRTL reports whether r is a strong right-to-left character. Arabic-Indic
+// digits are in the Arabic block but read left to right.
+func isRTL(r rune) bool {
+	return !unicode.IsDigit(r) && unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana)
+}
+
+// isStrongLTR reports whether r is a strong left-to-right character
+func isStrongLTR(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isRTL(r)
+}
+
+// IsRTL reports whether a paragraph reads right to left, going by its first strong character
+func IsRTL(text string) bool {
+	for _, r := range text {
+		if isRTL(r) {
+			return true
+		}
+		if isStrongLTR(r) {
+			return false
+		}
+	}
+	return false
+}
+
+// mirrored swaps paired punctuation inside right-to-left runs
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{',
+	'<': '>', '>': '<', '«': '»', '»': '«',
+}
+
+// Visual reorders one line from logical to visual (left-to-right drawing)
+// order. It is a simplified bidi algorithm: neutrals take the direction of
+// the strong characters around them, falling back to the paragraph direction.
+func Visual(line string, rtl bool) string {
+	runes := []rune(line)
+	if len(runes) == 0 {
+		return line
+	}
+
+	dirs := make([]bool, len(runes)) // true = right to left
+	for i, r := range runes {
+		switch {
+		case isRTL(r):
+			dirs[i] = true
+		case isStrongLTR(r):
+			dirs[i] = false
+		default:
+			before, after := rtl, rtl
+			for j := i - 1; j >= 0; j-- {
+				if isRTL(runes[j]) || isStrongLTR(runes[j]) {
+					before = isRTL(runes[j])
+					break
+				}
+			}
+			for j := i + 1; j < len(runes); j++ {
+				if isRTL(runes[j]) || isStrongLTR(runes[j]) {
+					after = isRTL(runes[j])
+					break
+				}
+			}
+			if before == after {
+				dirs[i] = before
+			} else {
+				dirs[i] = rtl
+			}
+		}
+	}
+
+	// Split into runs of one direction
+	type run struct {
+		rtl   bool
+		runes []rune
+	}
+	var runs []run
+	for i, r := range runes {
+		if len(runs) == 0 || runs[len(runs)-1].rtl != dirs[i] {
+			runs = append(runs, run{rtl: dirs[i]})
+		}
+		runs[len(runs)-1].runes = append(runs[len(runs)-1].runes, r)
+	}
+
+	for _, run := range runs {
+		if !run.rtl {
+			continue
+		}
+		for i, j := 0, len(run.runes)-1; i < j; i, j = i+1, j-1 {
+			run.runes[i], run.runes[j] = run.runes[j], run.runes[i]
+		}
+		for i, r := range run.runes {
+			if m, ok := mirrored[r]; ok {
+				run.runes[i] = m
+			}
+		}
+	}
+
+	if rtl {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+
+	out := make([]rune, 0, len(runes))
+	for _, run := range runs {
+		out = append(out, run.runes...)
+	}
+	return string(out)
+}
@@ -0,0 +1,67 @@
+package federation
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is how many redirects a fetch may follow
+const maxRedirects = 5
+
+// ErrPrivateAddress is returned for connections to loopback, private or
+// link-local addresses
+var ErrPrivateAddress = errors.New("refusing to connect to a non-public address")
+
+// sharedAddressSpace is carrier-grade NAT (RFC 6598), private in practice
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether ip is on the public internet
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// NewClient returns the HTTP client for fetching from and delivering to other
+// servers. Their URLs come from remote documents, so it won't reach internal
+// services: every address it dials must be public, checked after DNS
+// resolution, and checkURL runs again on every redirect. allowPrivate lifts
+// the address check, for development against a local stub server.
+func NewClient(timeout time.Duration, checkURL func(string) error, allowPrivate func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // The dialer must see the real destination
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkURL(req.URL.String())
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package federation
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // Cloud metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("PublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	allowAll := func(string) error { return nil }
+
+	client := NewClient(time.Second, allowAll, func() bool { return false })
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("GET %s: got %v, want ErrPrivateAddress", server.URL, err)
+	}
+
+	client = NewClient(time.Second, allowAll, func() bool { return true })
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET %s with private addresses allowed: %v", server.URL, err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientChecksRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/internal", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	refuseInternal := func(raw string) error {
+		if strings.HasSuffix(raw, "/internal") {
+			return errors.New("refused")
+		}
+		return nil
+	}
+	client := NewClient(time.Second, refuseInternal, func() bool { return true })
+	if _, err := client.Get(server.URL + "/start"); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("redirect was followed: %v", err)
+	}
+}
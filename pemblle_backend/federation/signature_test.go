@@ -0,0 +1,168 @@
+package federation
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKeyID = "https://pemblle.example/ap/actors/1#main-key"
+
+// stubInbox verifies every POST like a remote server would and records the
+// outcome of the last one
+type stubInbox struct {
+	key     *rsa.PublicKey
+	headers http.Header
+	err     error
+}
+
+func (s *stubInbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.headers = r.Header.Clone()
+
+	header := func(name string) string {
+		if strings.EqualFold(name, "host") {
+			return r.Host
+		}
+		return r.Header.Get(name)
+	}
+
+	sig, err := ParseSignature(r.Header.Get("Signature"))
+	if err == nil {
+		err = sig.Verify(r.Method, r.RequestURI, header, body, s.key)
+	}
+	if s.err = err; err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	_, privatePEM, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// post signs body and sends it to the inbox; tamper may change the request
+// after signing, as a man in the middle would
+func post(t *testing.T, inbox string, key *rsa.PrivateKey, body []byte, tamper func(*http.Request)) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if err := Sign(req, body, testKeyID, key); err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(req)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSignedDelivery(t *testing.T) {
+	key := newTestKey(t)
+	inbox := &stubInbox{key: &key.PublicKey}
+	server := httptest.NewServer(inbox)
+	defer server.Close()
+
+	body := []byte(`{"type":"Create","actor":"https://pemblle.example/ap/actors/1"}`)
+	if status := post(t, server.URL+"/ap/actors/2/inbox?x=1", key, body, nil); status != http.StatusAccepted {
+		t.Fatalf("signed delivery got %d: %v", status, inbox.err)
+	}
+
+	if got := inbox.headers.Get("Digest"); got != Digest(body) {
+		t.Errorf("Digest = %q, want %q", got, Digest(body))
+	}
+	date, err := http.ParseTime(inbox.headers.Get("Date"))
+	if err != nil {
+		t.Errorf("Date %q: %v", inbox.headers.Get("Date"), err)
+	} else if skew := time.Since(date); skew < -time.Minute || skew > time.Minute {
+		t.Errorf("Date is %v off", skew)
+	}
+
+	sig, err := ParseSignature(inbox.headers.Get("Signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.KeyID != testKeyID || sig.Algorithm != "rsa-sha256" {
+		t.Errorf("keyId %q, algorithm %q", sig.KeyID, sig.Algorithm)
+	}
+	if got := strings.Join(sig.Headers, " "); got != "(request-target) host date digest" {
+		t.Errorf("signed headers %q", got)
+	}
+}
+
+func TestRejectedDelivery(t *testing.T) {
+	key := newTestKey(t)
+	inbox := &stubInbox{key: &key.PublicKey}
+	server := httptest.NewServer(inbox)
+	defer server.Close()
+
+	body := []byte(`{"type":"Follow","actor":"https://pemblle.example/ap/actors/1"}`)
+	tampered := []byte(`{"type":"Follow","actor":"https://evil.example/actors/1"}`)
+
+	tests := []struct {
+		name   string
+		tamper func(*http.Request)
+	}{
+		{"tampered body", func(req *http.Request) {
+			req.Body = io.NopCloser(bytes.NewReader(tampered))
+			req.ContentLength = int64(len(tampered))
+		}},
+		{"tampered body with matching digest", func(req *http.Request) {
+			req.Body = io.NopCloser(bytes.NewReader(tampered))
+			req.ContentLength = int64(len(tampered))
+			req.Header.Set("Digest", Digest(tampered))
+		}},
+		{"changed date", func(req *http.Request) {
+			req.Header.Set("Date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		}},
+		{"stale date", func(req *http.Request) {
+			req.Header.Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+		}},
+		{"other inbox", func(req *http.Request) {
+			req.URL.Path = "/ap/actors/3/inbox"
+		}},
+		{"missing digest", func(req *http.Request) {
+			req.Header.Set("Signature", strings.Replace(req.Header.Get("Signature"), ` digest"`, `"`, 1))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := post(t, server.URL+"/ap/actors/2/inbox", key, body, tt.tamper); status != http.StatusUnauthorized {
+				t.Errorf("got %d, want %d", status, http.StatusUnauthorized)
+			}
+			if inbox.err == nil {
+				t.Error("inbox accepted the delivery")
+			}
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		if status := post(t, server.URL+"/ap/actors/2/inbox", newTestKey(t), body, nil); status != http.StatusUnauthorized {
+			t.Errorf("got %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,716 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"prswjo/federation"
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FederationHandler speaks ActivityPub so profiles can be followed from the fediverse
+type FederationHandler struct {
+	DB *gorm.DB
+}
+
+func NewFederationHandler(db *gorm.DB) *FederationHandler {
+	return &FederationHandler{DB: db}
+}
+
+const (
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+	publicCollection       = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// Delivery and caching knobs
+const (
+	deliveryBatch       = 50               // Deliveries attempted per run
+	deliveryMaxAttempts = 10               // Then the delivery is marked failed
+	deliveryMaxBackoff  = 12 * time.Hour   // Longest wait between attempts
+	deliveryLease       = 5 * time.Minute  // A crashed run's deliveries are retried after this
+	remoteActorTTL      = 24 * time.Hour   // Cached remote actors are refetched after this
+	outboxPageSize      = 20               // Activities per outbox page
+	federationTimeout   = 10 * time.Second // For fetching actors and delivering
+)
+
+var federationClient = federation.NewClient(federationTimeout, checkFetchURL, func() bool {
+	return os.Getenv("FEDERATION_ALLOW_PRIVATE") == "true"
+})
+
+// actorURL is the ActivityPub ID of a local user. It uses the user ID, not
+// the username, so it never changes.
+func actorURL(userID uuid.UUID) string {
+	return utils.PublicURL() + "/ap/actors/" + userID.String()
+}
+
+// noteURL is the ActivityPub ID of an answer
+func noteURL(answerID uuid.UUID) string {
+	return utils.PublicURL() + "/ap/notes/" + answerID.String()
+}
+
+// activityJSON sends an ActivityPub document
+func activityJSON(c *fiber.Ctx, doc fiber.Map) error {
+	c.Set(fiber.HeaderContentType, federation.ContentType+"; charset=utf-8")
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not encode document"})
+	}
+	return c.Send(body)
+}
+
+// actorKey returns the user's signing key, creating it on first use
+func actorKey(db *gorm.DB, userID uuid.UUID) (*models.ActorKey, error) {
+	var key models.ActorKey
+	err := db.First(&key, "user_id = ?", userID).Error
+	if err == nil {
+		return &key, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	publicPEM, privatePEM, err := federation.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	key = models.ActorKey{UserID: userID, PublicKeyPEM: publicPEM, PrivateKeyPEM: privatePEM}
+
+	// Another request may have generated one meanwhile; theirs wins
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&key).Error; err != nil {
+		return nil, err
+	}
+	if err := db.First(&key, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// federatedUser finds the verified user behind an actor ID in the path
+func (h *FederationHandler) federatedUser(c *fiber.Ctx) (*models.User, error) {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := h.DB.Where("id = ? AND is_verified = ?", userID, true).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// WebFinger resolves acct:username@host to the user's actor
+func (h *FederationHandler) WebFinger(c *fiber.Ctx) error {
+	resource := strings.TrimPrefix(c.Query("resource"), "acct:")
+	username, host, ok := strings.Cut(resource, "@")
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid resource"})
+	}
+
+	public, _ := url.Parse(utils.PublicURL())
+	if !strings.EqualFold(host, public.Host) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown host"})
+	}
+
+	var user models.User
+	if result := h.DB.Where("LOWER(username) = ? AND is_verified = ?", strings.ToLower(username), true).First(&user); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	profileURL := utils.FrontendURL() + "/u/" + url.PathEscape(user.Username)
+	c.Set(fiber.HeaderContentType, "application/jrd+json; charset=utf-8")
+	return c.JSON(fiber.Map{
+		"subject": "acct:" + user.Username + "@" + public.Host,
+		"aliases": []string{actorURL(user.ID), profileURL},
+		"links": []fiber.Map{
+			{"rel": "self", "type": federation.ContentType, "href": actorURL(user.ID)},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": profileURL},
+		},
+	})
+}
+
+// GetActor serves a user's Person document
+func (h *FederationHandler) GetActor(c *fiber.Ctx) error {
+	user, err := h.federatedUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Actor not found"})
+	}
+
+	key, err := actorKey(h.DB, user.ID)
+	if err != nil {
+		log.Printf("❌ Could not load actor key for %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not load actor"})
+	}
+
+	actor := actorURL(user.ID)
+	doc := fiber.Map{
+		"@context":                  []string{activityStreamsContext, securityContext},
+		"id":                        actor,
+		"type":                      "Person",
+		"preferredUsername":         user.Username,
+		"name":                      displayName(*user),
+		"summary":                   user.Bio,
+		"url":                       utils.FrontendURL() + "/u/" + url.PathEscape(user.Username),
+		"inbox":                     actor + "/inbox",
+		"outbox":                    actor + "/outbox",
+		"followers":                 actor + "/followers",
+		"manuallyApprovesFollowers": false,
+		"discoverable":              true,
+		"published":                 user.CreatedAt.UTC().Format(time.RFC3339),
+		"publicKey": fiber.Map{
+			"id":           actor + "#main-key",
+			"owner":        actor,
+			"publicKeyPem": key.PublicKeyPEM,
+		},
+	}
+	if user.Avatar != "" {
+		avatar := user.Avatar
+		if strings.HasPrefix(avatar, "/") {
+			avatar = utils.PublicURL() + avatar
+		}
+		doc["icon"] = fiber.Map{"type": "Image", "url": avatar}
+	}
+
+	return activityJSON(c, doc)
+}
+
+// GetFollowers serves the size of a user's fediverse followers collection
+func (h *FederationHandler) GetFollowers(c *fiber.Ctx) error {
+	user, err := h.federatedUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Actor not found"})
+	}
+
+	var count int64
+	h.DB.Model(&models.RemoteFollower{}).Where("user_id = ?", user.ID).Count(&count)
+
+	// Individual followers are not listed, only counted
+	return activityJSON(c, fiber.Map{
+		"@context":   activityStreamsContext,
+		"id":         actorURL(user.ID) + "/followers",
+		"type":       "OrderedCollection",
+		"totalItems": count,
+	})
+}
+
+// answerNote renders an answered tell as a Note. The sender is never part of
+// it, so anonymous tells stay anonymous on other servers.
+func answerNote(tell models.Tell, receiver models.User) fiber.Map {
+	actor := actorURL(receiver.ID)
+	note := fiber.Map{
+		"id":           noteURL(tell.Answer.ID),
+		"type":         "Note",
+		"attributedTo": actor,
+		"content":      feedEntryHTML(tell),
+		"published":    tell.Answer.CreatedAt.UTC().Format(time.RFC3339),
+		"url":          utils.FrontendURL() + "/u/" + url.PathEscape(receiver.Username) + "#" + tell.ID.String(),
+		"to":           []string{publicCollection},
+		"cc":           []string{actor + "/followers"},
+	}
+	if tell.Answer.EditedAt != nil {
+		note["updated"] = tell.Answer.EditedAt.UTC().Format(time.RFC3339)
+	}
+	return note
+}
+
+// createActivity wraps a Note in the Create activity that published it
+func createActivity(note fiber.Map) fiber.Map {
+	return fiber.Map{
+		"id":        note["id"].(string) + "/activity",
+		"type":      "Create",
+		"actor":     note["attributedTo"],
+		"published": note["published"],
+		"to":        note["to"],
+		"cc":        note["cc"],
+		"object":    note,
+	}
+}
+
+// GetNote serves a single public answer as a Note
+func (h *FederationHandler) GetNote(c *fiber.Ctx) error {
+	var answer models.Answer
+	if result := h.DB.First(&answer, "id = ?", c.Params("id")); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Note not found"})
+	}
+
+	var tell models.Tell
+	if result := h.DB.First(&tell, "id = ?", answer.TellID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Note not found"})
+	}
+	tell.Answer = &answer
+
+	var receiver models.User
+	if result := h.DB.Where("id = ? AND is_verified = ?", tell.ReceiverID, true).First(&receiver); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Note not found"})
+	}
+
+	note := answerNote(tell, receiver)
+	note["@context"] = activityStreamsContext
+	return activityJSON(c, note)
+}
+
+// GetOutbox serves a user's answers as Create activities, newest first.
+// Without ?page=true it returns the collection summary.
+func (h *FederationHandler) GetOutbox(c *fiber.Ctx) error {
+	user, err := h.federatedUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Actor not found"})
+	}
+
+	outbox := actorURL(user.ID) + "/outbox"
+	base := h.DB.Model(&models.Tell{}).
+		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+		Where("tells.receiver_id = ?", user.ID)
+
+	if c.Query("page") != "true" {
+		var count int64
+		if result := base.Count(&count); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch outbox"})
+		}
+		return activityJSON(c, fiber.Map{
+			"@context":   activityStreamsContext,
+			"id":         outbox,
+			"type":       "OrderedCollection",
+			"totalItems": count,
+			"first":      outbox + "?page=true",
+		})
+	}
+
+	query := base.Preload("Answer")
+	pageID := outbox + "?page=true"
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+		query = query.Where("(answers.created_at, tells.id) < (?, ?)", after.CreatedAt, after.ID)
+		pageID += "&cursor=" + url.QueryEscape(cursor)
+	}
+
+	var tells []models.Tell
+	if result := query.Order("answers.created_at desc").Order("tells.id desc").Limit(outboxPageSize + 1).Find(&tells); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch outbox"})
+	}
+
+	page := fiber.Map{
+		"@context": activityStreamsContext,
+		"id":       pageID,
+		"type":     "OrderedCollectionPage",
+		"partOf":   outbox,
+	}
+	if len(tells) > outboxPageSize {
+		tells = tells[:outboxPageSize]
+		last := tells[len(tells)-1]
+		page["next"] = outbox + "?page=true&cursor=" + url.QueryEscape(encodeCursor(last.Answer.CreatedAt, last.ID))
+	}
+
+	items := make([]fiber.Map, len(tells))
+	for i, tell := range tells {
+		items[i] = createActivity(answerNote(tell, *user))
+	}
+	page["orderedItems"] = items
+
+	return activityJSON(c, page)
+}
+
+// inboxActivity is the part of an incoming activity the inbox looks at
+type inboxActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// objectRef reads an activity's object, which may be a bare ID or an embedded object
+func (a inboxActivity) objectRef() (inboxActivity, error) {
+	var ref inboxActivity
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		ref.ID = id
+		return ref, nil
+	}
+	err := json.Unmarshal(a.Object, &ref)
+	return ref, err
+}
+
+// Inbox accepts signed Follow and Undo{Follow} activities for a local user
+func (h *FederationHandler) Inbox(c *fiber.Ctx) error {
+	user, err := h.federatedUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Actor not found"})
+	}
+
+	body := c.Body()
+	sig, err := federation.ParseSignature(c.Get("Signature"))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing or invalid signature"})
+	}
+
+	remote, err := h.remoteActorByKey(sig.KeyID)
+	if err != nil {
+		log.Printf("❌ Could not fetch key %s: %v", sig.KeyID, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Could not verify signature"})
+	}
+	key, err := federation.ParsePublicKey(remote.PublicKeyPEM)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Could not verify signature"})
+	}
+	if err := sig.Verify(c.Method(), c.OriginalURL(), func(name string) string { return c.Get(name) }, body, key); err != nil {
+		log.Printf("❌ Rejected inbox delivery from %s: %v", remote.ID, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid signature"})
+	}
+
+	var activity inboxActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid activity"})
+	}
+
+	// The signer may only act for itself
+	if activity.Actor != remote.ID {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Actor does not match signature"})
+	}
+
+	local := actorURL(user.ID)
+	switch activity.Type {
+	case "Follow":
+		object, err := activity.objectRef()
+		if err != nil || object.ID != local {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Follow object is not this actor"})
+		}
+
+		follower := models.RemoteFollower{UserID: user.ID, ActorID: remote.ID, FollowID: activity.ID}
+		if result := h.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "actor_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"follow_id"}),
+		}).Create(&follower); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save follower"})
+		}
+
+		var followActivity interface{} = activity.ID
+		if activity.ID == "" {
+			followActivity = json.RawMessage(body)
+		}
+		accept := fiber.Map{
+			"id":     local + "#accepts/" + uuid.NewString(),
+			"type":   "Accept",
+			"actor":  local,
+			"object": followActivity,
+		}
+		if err := enqueueActivity(h.DB, user.ID, remote.Inbox, accept); err != nil {
+			log.Printf("❌ Could not queue Accept for %s: %v", remote.ID, err)
+		}
+		log.Printf("🌐 %s followed %s", remote.ID, user.Username)
+
+	case "Undo":
+		object, err := activity.objectRef()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Undo object"})
+		}
+
+		// Either the embedded Follow, or just the ID of a Follow we stored
+		query := h.DB.Where("user_id = ? AND actor_id = ?", user.ID, remote.ID)
+		if object.Type != "Follow" {
+			query = query.Where("follow_id = ?", object.ID)
+		}
+		if result := query.Delete(&models.RemoteFollower{}); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not remove follower"})
+		}
+		log.Printf("🌐 %s unfollowed %s", remote.ID, user.Username)
+	}
+
+	// Everything else is accepted and ignored
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// checkFetchURL refuses to fetch anything but https, unless FEDERATION_ALLOW_HTTP
+// is set (for development against a local stub server). federationClient
+// also refuses non-public addresses unless FEDERATION_ALLOW_PRIVATE is set.
+func checkFetchURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "https" || (u.Scheme == "http" && os.Getenv("FEDERATION_ALLOW_HTTP") == "true") {
+		return nil
+	}
+	return fmt.Errorf("refusing to fetch %q", raw)
+}
+
+// sameOrigin reports whether two URLs share a scheme and host
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// fetchActivityJSON GETs an ActivityPub document
+func fetchActivityJSON(raw string, into interface{}) error {
+	if err := checkFetchURL(raw); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, raw, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", federation.ContentType+`, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", raw, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(into)
+}
+
+// remoteActorDoc is the part of a remote actor (or key) document we use
+type remoteActorDoc struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"` // Set when keyId resolves to a bare key document
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// remoteActorByKey returns the actor owning keyID, from cache or fetched fresh
+func (h *FederationHandler) remoteActorByKey(keyID string) (*models.RemoteActor, error) {
+	var cached models.RemoteActor
+	if err := h.DB.Where("public_key_id = ? AND fetched_at > ?", keyID, time.Now().Add(-remoteActorTTL)).
+		First(&cached).Error; err == nil {
+		return &cached, nil
+	}
+
+	actorID, _, _ := strings.Cut(keyID, "#")
+
+	var doc remoteActorDoc
+	if err := fetchActivityJSON(actorID, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Inbox == "" && doc.Owner != "" {
+		// keyId is a bare key document; its owner must live on the same server
+		if !sameOrigin(doc.Owner, keyID) {
+			return nil, errors.New("key owner is on another server")
+		}
+		actorID = doc.Owner
+		doc = remoteActorDoc{}
+		if err := fetchActivityJSON(actorID, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if doc.ID == "" || doc.Inbox == "" {
+		return nil, errors.New("not an actor document")
+	}
+	// Only the actor's own server can speak for it: a document claiming to be
+	// someone else would let its server take over their cached key and inbox
+	if doc.ID != actorID || !sameOrigin(doc.ID, keyID) {
+		return nil, errors.New("actor document is not from the actor's server")
+	}
+	if doc.PublicKey.ID != keyID || doc.PublicKey.Owner != doc.ID {
+		return nil, errors.New("key does not belong to actor")
+	}
+
+	var existing models.RemoteActor
+	if err := h.DB.Select("public_key_id").First(&existing, "id = ?", doc.ID).Error; err == nil && !sameOrigin(existing.PublicKeyID, keyID) {
+		return nil, errors.New("actor already has a key from another server")
+	}
+
+	actor := models.RemoteActor{
+		ID:           doc.ID,
+		Inbox:        doc.Inbox,
+		SharedInbox:  doc.Endpoints.SharedInbox,
+		PublicKeyID:  doc.PublicKey.ID,
+		PublicKeyPEM: doc.PublicKey.PublicKeyPem,
+		FetchedAt:    time.Now(),
+	}
+	if err := h.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&actor).Error; err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// enqueueActivity queues a signed delivery of activity to inbox
+func enqueueActivity(db *gorm.DB, userID uuid.UUID, inbox string, activity fiber.Map) error {
+	if _, ok := activity["@context"]; !ok {
+		activity["@context"] = activityStreamsContext
+	}
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&models.ActivityDelivery{
+		UserID:        userID,
+		Inbox:         inbox,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// publishAnswer queues a Create for a new answer to each remote follower's
+// inbox, using shared inboxes so each server gets one copy
+func publishAnswer(db *gorm.DB, tell models.Tell, answer models.Answer) {
+	var followers []models.RemoteFollower
+	if err := db.Preload("Actor").Where("user_id = ?", tell.ReceiverID).Find(&followers).Error; err != nil {
+		log.Printf("❌ Could not load remote followers: %v", err)
+		return
+	}
+	if len(followers) == 0 {
+		return
+	}
+
+	var receiver models.User
+	if err := db.First(&receiver, "id = ?", tell.ReceiverID).Error; err != nil {
+		log.Printf("❌ Could not load answer receiver: %v", err)
+		return
+	}
+
+	tell.Answer = &answer
+	activity := createActivity(answerNote(tell, receiver))
+
+	inboxes := make(map[string]bool)
+	for _, follower := range followers {
+		if follower.Actor == nil {
+			continue
+		}
+		inbox := follower.Actor.SharedInbox
+		if inbox == "" {
+			inbox = follower.Actor.Inbox
+		}
+		if inboxes[inbox] {
+			continue
+		}
+		inboxes[inbox] = true
+
+		if err := enqueueActivity(db, receiver.ID, inbox, activity); err != nil {
+			log.Printf("❌ Could not queue delivery to %s: %v", inbox, err)
+		}
+	}
+}
+
+// claimDeliveriesSQL takes due deliveries and pushes their next attempt past
+// the lease, so a second job run or instance skips them while they are sent
+// and a crashed run's deliveries are picked up again once it runs out
+const claimDeliveriesSQL = `
+UPDATE activity_deliveries SET
+	next_attempt_at = @leased_until,
+	attempts = attempts + 1
+WHERE id IN (
+	SELECT id FROM activity_deliveries
+	WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= @now
+	ORDER BY next_attempt_at
+	LIMIT @limit
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+
+// DeliverActivities sends due deliveries, backing off exponentially on failure
+func (h *FederationHandler) DeliverActivities() error {
+	now := time.Now()
+
+	var due []models.ActivityDelivery
+	if err := h.DB.Raw(claimDeliveriesSQL, map[string]interface{}{
+		"leased_until": now.Add(deliveryLease),
+		"now":          now,
+		"limit":        deliveryBatch,
+	}).Scan(&due).Error; err != nil {
+		return err
+	}
+
+	for _, delivery := range due {
+		err := h.deliver(delivery)
+		now := time.Now()
+
+		if err == nil {
+			h.DB.Model(&delivery).Update("delivered_at", now)
+			continue
+		}
+
+		updates := map[string]interface{}{"last_error": err.Error()}
+		if delivery.Attempts >= deliveryMaxAttempts {
+			updates["failed_at"] = now
+			log.Printf("❌ Giving up delivering to %s: %v", delivery.Inbox, err)
+		} else {
+			backoff := time.Minute << delivery.Attempts
+			if backoff > deliveryMaxBackoff {
+				backoff = deliveryMaxBackoff
+			}
+			updates["next_attempt_at"] = now.Add(backoff)
+		}
+		h.DB.Model(&delivery).Updates(updates)
+	}
+
+	return nil
+}
+
+// deliver POSTs one activity, signed with the sending user's key
+func (h *FederationHandler) deliver(delivery models.ActivityDelivery) error {
+	if err := checkFetchURL(delivery.Inbox); err != nil {
+		return err
+	}
+
+	key, err := actorKey(h.DB, delivery.UserID)
+	if err != nil {
+		return err
+	}
+	privateKey, err := federation.ParsePrivateKey(key.PrivateKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, delivery.Inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", federation.ContentType)
+	req.Header.Set("Accept", federation.ContentType)
+
+	if err := federation.Sign(req, body, actorURL(delivery.UserID)+"#main-key", privateKey); err != nil {
+		return err
+	}
+
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", delivery.Inbox, resp.Status)
+	}
+	return nil
+}
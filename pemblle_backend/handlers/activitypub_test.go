@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"prswjo/federation"
+	"prswjo/models"
+	"prswjo/testdb"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestDeliverActivities runs the delivery queue against a stub inbox that
+// checks the signature with the sending user's public key
+func TestDeliverActivities(t *testing.T) {
+	h := &FederationHandler{DB: testdb.Open(t)}
+	t.Setenv("FEDERATION_ALLOW_HTTP", "true")
+	t.Setenv("FEDERATION_ALLOW_PRIVATE", "true")
+
+	user := models.User{Username: "sender", Email: "sender@example.com"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := actorKey(h.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := federation.ParsePublicKey(key.PublicKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received atomic.Int32
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sig, err := federation.ParseSignature(r.Header.Get("Signature"))
+		if err == nil && sig.KeyID != actorURL(user.ID)+"#main-key" {
+			t.Errorf("keyId %q", sig.KeyID)
+		}
+		if err == nil {
+			err = sig.Verify(r.Method, r.RequestURI, func(name string) string {
+				if name == "host" {
+					return r.Host
+				}
+				return r.Header.Get(name)
+			}, body, publicKey)
+		}
+		if err != nil {
+			t.Errorf("inbox rejected delivery: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer inbox.Close()
+
+	if err := enqueueActivity(h.DB, user.ID, inbox.URL+"/inbox", fiber.Map{"type": "Create", "actor": actorURL(user.ID)}); err != nil {
+		t.Fatal(err)
+	}
+	// Overlapping runs must not deliver twice
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.DeliverActivities(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := received.Load(); n != 1 {
+		t.Errorf("inbox got %d deliveries, want 1", n)
+	}
+	var delivery models.ActivityDelivery
+	if err := h.DB.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.DeliveredAt == nil || delivery.Attempts != 1 {
+		t.Errorf("delivery not recorded: delivered_at %v, attempts %d, last error %q", delivery.DeliveredAt, delivery.Attempts, delivery.LastError)
+	}
+}
+
+// TestRemoteActorByKey checks a server can only vouch for its own actors
+func TestRemoteActorByKey(t *testing.T) {
+	h := &FederationHandler{DB: testdb.Open(t)}
+	t.Setenv("FEDERATION_ALLOW_HTTP", "true")
+	t.Setenv("FEDERATION_ALLOW_PRIVATE", "true")
+
+	publicPEM, _, err := federation.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := make(map[string]fiber.Map)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", federation.ContentType)
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer server.Close()
+
+	actor := server.URL + "/users/bob"
+	docs["/users/bob"] = fiber.Map{
+		"id":        actor,
+		"inbox":     actor + "/inbox",
+		"publicKey": fiber.Map{"id": actor + "#main-key", "owner": actor, "publicKeyPem": publicPEM},
+	}
+	// Claims to be someone on another server, with a key it controls
+	victim := "https://mastodon.example/users/alice"
+	docs["/users/mallory"] = fiber.Map{
+		"id":        victim,
+		"inbox":     server.URL + "/inbox",
+		"publicKey": fiber.Map{"id": server.URL + "/users/mallory#main-key", "owner": victim, "publicKeyPem": publicPEM},
+	}
+	// A bare key document handing off to an actor elsewhere
+	docs["/keys/mallory"] = fiber.Map{"id": server.URL + "/keys/mallory", "owner": victim, "publicKeyPem": publicPEM}
+
+	remote, err := h.remoteActorByKey(actor + "#main-key")
+	if err != nil {
+		t.Fatalf("own actor: %v", err)
+	}
+	if remote.ID != actor || remote.Inbox != actor+"/inbox" {
+		t.Errorf("got %+v", remote)
+	}
+
+	for _, keyID := range []string{server.URL + "/users/mallory#main-key", server.URL + "/keys/mallory"} {
+		if _, err := h.remoteActorByKey(keyID); err == nil {
+			t.Errorf("%s: accepted an actor from another server", keyID)
+		}
+	}
+	var count int64
+	h.DB.Model(&models.RemoteActor{}).Where("id = ?", victim).Count(&count)
+	if count != 0 {
+		t.Error("impersonated actor was cached")
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	"prswjo/mail"
+	"prswjo/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminHandler serves operator tools
+type AdminHandler struct {
+	DB     *gorm.DB
+	Outbox *mail.Outbox
+}
+
+func NewAdminHandler(db *gorm.DB, outbox *mail.Outbox) *AdminHandler {
+	return &AdminHandler{DB: db, Outbox: outbox}
+}
+
+// GetEmails lists the email outbox, newest first, optionally by ?status= and ?recipient=
+func (h *AdminHandler) GetEmails(c *fiber.Ctx) error {
+	limit := parseLimit(c)
+
+	// Bodies are left out of the listing; GetEmail has them
+	query := h.DB.Omit("html", "text")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if recipient := c.Query("recipient"); recipient != "" {
+		query = query.Where("recipient = ?", recipient)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var emails []models.OutboundEmail
+	if result := query.Order("created_at desc").Order("id desc").Limit(limit + 1).Find(&emails); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch emails"})
+	}
+
+	var nextCursor *string
+	if len(emails) > limit {
+		emails = emails[:limit]
+		last := emails[len(emails)-1]
+		next := encodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &next
+	}
+
+	// Counts per status give the outbox's health at a glance
+	var counts []struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+	h.DB.Model(&models.OutboundEmail{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts)
+
+	response := pageResponse(emails, nextCursor)
+	response["counts"] = counts
+	return c.JSON(response)
+}
+
+// GetEmail returns one outbox email including its body
+func (h *AdminHandler) GetEmail(c *fiber.Ctx) error {
+	var email models.OutboundEmail
+	if result := h.DB.First(&email, "id = ?", c.Params("id")); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Email not found"})
+	}
+	return c.JSON(email)
+}
+
+// RetryEmail sends a dead-lettered email again with a fresh set of attempts
+func (h *AdminHandler) RetryEmail(c *fiber.Ctx) error {
+	emailID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email ID"})
+	}
+
+	retried, err := h.Outbox.Retry(emailID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retry email"})
+	}
+	if !retried {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Only pending or dead emails can be retried"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetSuppressions lists addresses mail is no longer sent to, newest first,
+// optionally those containing ?address=
+func (h *AdminHandler) GetSuppressions(c *fiber.Ctx) error {
+	limit := parseLimit(c)
+
+	query := h.DB.Order("created_at desc").Limit(limit)
+	if address := c.Query("address"); address != "" {
+		query = query.Where("address LIKE ?", "%"+strings.ToLower(address)+"%")
+	}
+
+	var suppressions []models.EmailSuppression
+	if result := query.Find(&suppressions); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch suppressions"})
+	}
+
+	return c.JSON(suppressions)
+}
+
+// DeleteSuppression lets mail go to an address again and clears its user's
+// "please update your email" flag
+func (h *AdminHandler) DeleteSuppression(c *fiber.Ctx) error {
+	address, err := url.PathUnescape(c.Params("address"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid address"})
+	}
+
+	removed, err := h.Outbox.Unsuppress(address)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not remove suppression"})
+	}
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Address is not suppressed"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"log"
 	"os"
+	"strings"
 	"time"
 
+	"prswjo/mail"
 	"prswjo/models"
 	"prswjo/utils"
 
@@ -13,14 +15,16 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Outbox *mail.Outbox
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{DB: db}
+func NewAuthHandler(db *gorm.DB, outbox *mail.Outbox) *AuthHandler {
+	return &AuthHandler{DB: db, Outbox: outbox}
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
@@ -29,6 +33,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		FullName string `json:"full_name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Language string `json:"language"` // Defaults to the browser's language
 	}
 
 	var input RegisterInput
@@ -64,6 +69,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Email:             input.Email,
 		Password:          string(hashedPassword),
 		VerificationToken: verificationToken,
+		Language:          requestLanguage(c, input.Language),
 		ExpiresAt:         time.Now().Add(24 * time.Hour), // Token expires in 24 hours
 	}
 
@@ -74,13 +80,11 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	log.Printf("📝 Pending registration created: %s | Email: %s | Token: %s", pendingUser.Username, pendingUser.Email, pendingUser.VerificationToken)
 
 	// Send verification email
-	go func() {
-		if err := utils.SendVerificationEmail(pendingUser.Email, pendingUser.VerificationToken); err != nil {
-			log.Printf("❌ Failed to send verification email to %s: %v", pendingUser.Email, err)
-		} else {
-			log.Printf("📧 Verification email sent to %s", pendingUser.Email)
-		}
-	}()
+	if err := h.Outbox.Enqueue("verify:"+pendingUser.VerificationToken, utils.VerificationEmail(utils.Recipient{Email: pendingUser.Email, Language: pendingUser.Language}, pendingUser.VerificationToken)); err != nil {
+		log.Printf("❌ Failed to queue verification email to %s: %v", pendingUser.Email, err)
+	} else {
+		log.Printf("📧 Verification email queued for %s", pendingUser.Email)
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "Please check your email to verify your account.",
@@ -119,6 +123,7 @@ func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
 		FullName:   pendingUser.FullName,
 		Email:      pendingUser.Email,
 		Password:   pendingUser.Password,
+		Language:   utils.Language(pendingUser.Language),
 		IsVerified: true,
 	}
 
@@ -166,7 +171,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
 	}
 
-	return c.JSON(fiber.Map{"token": t, "user": user})
+	return c.JSON(fiber.Map{"token": t, "user": newOwnProfile(user)})
 }
 
 func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
@@ -202,6 +207,97 @@ func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Password updated successfully"})
 }
 
+// ChangeEmail starts moving the account to a new address. Nothing changes
+// until the link mailed there is opened, so a typo can't lock the user out.
+func (h *AuthHandler) ChangeEmail(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	type ChangeEmailInput struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	var input ChangeEmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	input.Email = strings.TrimSpace(input.Email)
+	if !strings.Contains(input.Email, "@") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email"})
+	}
+
+	var user models.User
+	if result := h.DB.First(&user, "id = ?", userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid password"})
+	}
+
+	var existingUser models.User
+	if result := h.DB.Where("email = ?", input.Email).First(&existingUser); result.Error == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email already registered"})
+	}
+
+	// A new request replaces any earlier one
+	change := models.EmailChange{
+		UserID:            user.ID,
+		Email:             input.Email,
+		VerificationToken: uuid.New().String(),
+		ExpiresAt:         time.Now().Add(24 * time.Hour),
+	}
+	if result := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "verification_token", "expires_at", "created_at"}),
+	}).Create(&change); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start email change"})
+	}
+
+	if err := h.Outbox.Enqueue("email-change:"+change.VerificationToken, utils.EmailChangeEmail(utils.Recipient{Email: change.Email, Language: user.Language}, change.VerificationToken)); err != nil {
+		log.Printf("❌ Failed to queue email change confirmation to %s: %v", change.Email, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send confirmation email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Please check your new email to confirm the change."})
+}
+
+// VerifyEmailChange moves the account to the verified address. Mail works
+// again, so EmailNeedsUpdate is cleared.
+func (h *AuthHandler) VerifyEmailChange(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	var change models.EmailChange
+	if result := h.DB.Where("verification_token = ?", token).First(&change); result.Error != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired verification token"})
+	}
+	if time.Now().After(change.ExpiresAt) {
+		h.DB.Delete(&change)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Verification token has expired. Please change your email again."})
+	}
+
+	// Someone may have registered the address in the meantime
+	var existingUser models.User
+	if result := h.DB.Where("email = ?", change.Email).First(&existingUser); result.Error == nil {
+		h.DB.Delete(&change)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email already registered"})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).
+			Updates(map[string]interface{}{"email": change.Email, "email_needs_update": false}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&change).Error
+	})
+	if err != nil {
+		log.Printf("❌ Failed to change email for %s: %v", change.UserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not change email"})
+	}
+
+	log.Printf("✅ Email changed for %s", change.UserID)
+	return c.JSON(fiber.Map{"message": "Email changed successfully."})
+}
+
 func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
 	type ResendInput struct {
 		Email string `json:"email"`
@@ -230,13 +326,20 @@ func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
 	h.DB.Save(&pendingUser)
 
 	// Send verification email
-	go func() {
-		if err := utils.SendVerificationEmail(pendingUser.Email, pendingUser.VerificationToken); err != nil {
-			log.Printf("❌ Failed to send verification email to %s: %v", pendingUser.Email, err)
-		} else {
-			log.Printf("📧 Verification email resent to %s", pendingUser.Email)
-		}
-	}()
+	if err := h.Outbox.Enqueue("verify:"+pendingUser.VerificationToken, utils.VerificationEmail(utils.Recipient{Email: pendingUser.Email, Language: pendingUser.Language}, pendingUser.VerificationToken)); err != nil {
+		log.Printf("❌ Failed to queue verification email to %s: %v", pendingUser.Email, err)
+	} else {
+		log.Printf("📧 Verification email re-queued for %s", pendingUser.Email)
+	}
 
 	return c.JSON(fiber.Map{"message": "Verification email sent"})
 }
+
+// requestLanguage is lang if emails can be written in it, else the best match
+// for the browser's Accept-Language
+func requestLanguage(c *fiber.Ctx, lang string) string {
+	if utils.ValidLanguage(lang) {
+		return lang
+	}
+	return utils.Language(c.AcceptsLanguages(utils.Languages...))
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"log"
+	"os"
+	"strings"
+
+	"prswjo/mail"
+	"prswjo/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// BounceHandler takes bounce and complaint reports from the mail provider
+type BounceHandler struct {
+	DB     *gorm.DB
+	Outbox *mail.Outbox
+}
+
+func NewBounceHandler(db *gorm.DB, outbox *mail.Outbox) *BounceHandler {
+	return &BounceHandler{DB: db, Outbox: outbox}
+}
+
+// ReceiveBounce is the webhook the mail provider posts reports to, with
+// BOUNCE_WEBHOOK_SECRET as a bearer token. The body is either a raw DSN or
+// ARF message, which must return an email we sent, or JSON naming the address:
+//
+//	{"email": "...", "type": "hard_bounce" | "complaint", "status": "5.1.1", "diagnostic": "..."}
+func (h *BounceHandler) ReceiveBounce(c *fiber.Ctx) error {
+	secret := os.Getenv("BOUNCE_WEBHOOK_SECRET")
+	if secret == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Bounce webhook is disabled"})
+	}
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid webhook secret"})
+	}
+
+	var suppressed int
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		var input struct {
+			Email      string `json:"email"`
+			Type       string `json:"type"`
+			Status     string `json:"status"`
+			Diagnostic string `json:"diagnostic"`
+		}
+		if err := c.BodyParser(&input); err != nil || input.Email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		}
+		if input.Type != models.SuppressHardBounce && input.Type != models.SuppressComplaint {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Type must be hard_bounce or complaint"})
+		}
+		if err := h.Outbox.Suppress(mail.Bounce{
+			Address:    input.Email,
+			Reason:     input.Type,
+			Status:     input.Status,
+			Diagnostic: input.Diagnostic,
+		}); err != nil {
+			log.Printf("❌ Could not suppress %s: %v", input.Email, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not record bounce"})
+		}
+		suppressed++
+	} else {
+		bounces, err := mail.ParseReport(bytes.NewReader(c.Body()))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse report"})
+		}
+		for _, bounce := range bounces {
+			ok, err := h.Outbox.SuppressReport(bounce)
+			if err != nil {
+				log.Printf("❌ Could not suppress %s: %v", bounce.Address, err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not record bounce"})
+			}
+			if ok {
+				suppressed++
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"suppressed": suppressed})
+}
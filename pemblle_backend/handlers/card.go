@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"prswjo/cards"
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// cardDir is where rendered answer cards are cached. It must stay outside
+// ./uploads, which is served as-is: cards are only served by GetAnswerCard,
+// which checks the answer is still there.
+const cardDir = "./cache/cards"
+
+// legacyCardDir is where cards used to be cached, inside ./uploads
+const legacyCardDir = "./uploads/cards"
+
+// RemoveLegacyCardCache deletes cards cached under ./uploads by earlier
+// versions, which anyone could fetch by path
+func RemoveLegacyCardCache() {
+	if err := os.RemoveAll(legacyCardDir); err != nil {
+		log.Printf("❌ Could not remove old card cache %s: %v", legacyCardDir, err)
+	}
+}
+
+// GetAnswerCard serves a public answer as a PNG card for link previews.
+// Cards are cached on disk under a hash of everything drawn on them.
+func (h *TellHandler) GetAnswerCard(c *fiber.Ctx) error {
+	var answer models.Answer
+	if result := h.DB.Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		First(&answer, "answers.id = ?", c.Params("id")); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	var tell models.Tell
+	if result := h.DB.First(&tell, "id = ?", answer.TellID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	var receiver models.User
+	if result := h.DB.Select("id, username, full_name").First(&receiver, "id = ?", tell.ReceiverID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	card := cards.Card{
+		Question: tell.Content,
+		Answer:   answer.Content,
+		FullName: receiver.FullName,
+		Username: receiver.Username,
+		SiteName: utils.SiteName(),
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s\x00%s\x00%s",
+		cards.Version, card.Question, card.Answer, card.FullName, card.Username, card.SiteName)))
+	key := hex.EncodeToString(hash[:16])
+	path := filepath.Join(cardDir, answer.ID.String()+"-"+key+".png")
+
+	c.Set(fiber.HeaderETag, `"`+key+`"`)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), `"`+key+`"`) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.SendFile(path)
+	}
+
+	png, err := cards.Render(card)
+	if err != nil {
+		log.Printf("❌ Could not render card for answer %s: %v", answer.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not render card"})
+	}
+
+	// Anything cached for this answer under another hash is stale now
+	removeAnswerCards(answer.ID)
+	if err := writeCard(path, png); err != nil {
+		log.Printf("❌ Could not cache card for answer %s: %v", answer.ID, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "image/png")
+	return c.Send(png)
+}
+
+// writeCard stores a rendered card, via a temp file so readers never see half a PNG
+func writeCard(path string, png []byte) error {
+	if err := os.MkdirAll(cardDir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(cardDir, "card-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(png); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeAnswerCards deletes every cached card of the given answers
+func removeAnswerCards(answerIDs ...uuid.UUID) {
+	for _, answerID := range answerIDs {
+		paths, _ := filepath.Glob(filepath.Join(cardDir, answerID.String()+"-*.png"))
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("❌ Could not remove card %s: %v", path, err)
+			}
+		}
+	}
+}
@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"prswjo/models"
-	"prswjo/utils"
+	"prswjo/notify"
 	"prswjo/ws"
 	"time"
 
@@ -12,11 +12,12 @@ import (
 )
 
 type ChatHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Notify *notify.Service
 }
 
-func NewChatHandler(db *gorm.DB) *ChatHandler {
-	return &ChatHandler{DB: db}
+func NewChatHandler(db *gorm.DB, notifier *notify.Service) *ChatHandler {
+	return &ChatHandler{DB: db, Notify: notifier}
 }
 
 // GetOrCreateChat gets existing chat or creates a new one between two users
@@ -44,6 +45,14 @@ func (h *ChatHandler) GetOrCreateChat(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	blocked, err := isBlockedBetween(h.DB, currentUUID, input.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check blocks"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can't chat with this user"})
+	}
+
 	// Find existing chat
 	var chat models.Chat
 	result := h.DB.Where(
@@ -171,6 +180,15 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not authorized"})
 	}
 
+	// A block ends an existing chat too
+	blocked, err := isBlockedBetween(h.DB, chat.User1ID, chat.User2ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check blocks"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can't chat with this user"})
+	}
+
 	// Create message
 	message := models.Message{
 		ChatID:   chatUUID,
@@ -194,23 +212,20 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 		otherUserID = chat.User2ID
 	}
 
+	// The chat itself always updates live; preferences only decide on the
+	// notification and email
 	ws.GlobalManager.SendMessage(otherUserID.String(), fiber.Map{
-		"type":    "new_message",
+		"type":    string(notify.Message),
 		"chat_id": chatUUID.String(),
 		"message": message,
 	})
 
-	// Send email notification to the other user
-	go func() {
-		var otherUser models.User
-		if err := h.DB.First(&otherUser, "id = ?", otherUserID).Error; err == nil && otherUser.Email != "" {
-			senderName := message.Sender.FullName
-			if senderName == "" {
-				senderName = message.Sender.Username
-			}
-			utils.SendNewMessageEmail(otherUser.Email, senderName)
-		}
-	}()
+	h.Notify.Send(notify.Event{
+		UserID:  otherUserID,
+		ActorID: &currentUUID,
+		Payload: notify.MessagePayload{ChatID: chatUUID, MessageID: message.ID, Preview: notify.Preview(message.Content)},
+		Live:    true,
+	})
 
 	return c.JSON(message)
 }
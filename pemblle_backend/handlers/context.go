@@ -0,0 +1,10 @@
+package handlers
+
+import "github.com/gofiber/fiber/v2"
+
+// viewerID returns the authenticated user's ID on routes behind
+// middleware.OptionalAuth, or "" for anonymous visitors
+func viewerID(c *fiber.Ctx) string {
+	userID, _ := c.Locals("user_id").(string)
+	return userID
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"prswjo/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ranking knobs for the "For You" feed
+const (
+	rankedFeedWindow      = 7 * 24 * time.Hour // Only answers newer than this are candidates
+	rankedFeedHalfLife    = 24 * time.Hour     // Score halves for every day an answer ages
+	rankedFeedSize        = 200                // Rows materialized per user
+	rankedFeedPerReceiver = 3                  // Diversity cap: max answers from the same profile
+	rankedFeedFollowBoost = 3.0                // Answers from people you follow
+	rankedFeedFoFBoost    = 1.5                // Answers from people followed by people you follow
+	rankedFeedActive      = 3 * 24 * time.Hour // Only users who opened "For You" this recently are ranked
+	feedViewedThrottle    = 10 * time.Minute   // How often a viewer's FeedViewedAt is written
+)
+
+// rankFeedSQL scores recent answers for one viewer and stores the top of the list,
+// leaving out profiles blocked either way.
+// score = recency decay * (1 + ln(1 + likes + 2*replies)) * social proximity,
+// then at most rankedFeedPerReceiver answers are kept for each profile.
+const rankFeedSQL = `
+INSERT INTO feed_entries (user_id, rank, tell_id, score, computed_at)
+SELECT CAST(@viewer AS uuid), ROW_NUMBER() OVER (ORDER BY score DESC, tell_id DESC), tell_id, score, CAST(@now AS timestamptz)
+FROM (
+	SELECT tell_id, score, ROW_NUMBER() OVER (PARTITION BY receiver_id ORDER BY score DESC, tell_id DESC) AS per_receiver
+	FROM (
+		SELECT tells.id AS tell_id, tells.receiver_id,
+			POWER(0.5, EXTRACT(EPOCH FROM (CAST(@now AS timestamptz) - answers.created_at)) / @half_life)
+			* (1 + LN(1 + answers.like_count + 2 * answers.reply_count))
+			* CASE
+				WHEN tells.receiver_id IN (SELECT following_id FROM follows WHERE follower_id = @viewer) THEN @follow_boost
+				WHEN tells.receiver_id IN (
+					SELECT f2.following_id FROM follows f1
+					INNER JOIN follows f2 ON f2.follower_id = f1.following_id
+					WHERE f1.follower_id = @viewer
+				) THEN @fof_boost
+				ELSE 1
+			END AS score
+		FROM tells
+		INNER JOIN answers ON answers.tell_id = tells.id
+		WHERE tells.deleted_at IS NULL
+			AND answers.created_at > @since
+			AND tells.receiver_id <> @viewer
+			AND tells.receiver_id NOT IN (
+				SELECT blocked_id FROM blocks WHERE blocker_id = @viewer
+				UNION SELECT blocker_id FROM blocks WHERE blocked_id = @viewer
+			)
+	) scored
+) capped
+WHERE per_receiver <= @per_receiver
+ORDER BY score DESC, tell_id DESC
+LIMIT @size`
+
+// RefreshRankedFeeds rebuilds the materialized "For You" feed of every
+// verified user who opened it recently. Everyone else's feed is dropped, so
+// the cost follows active users rather than all of them; a returning user
+// gets the latest feed until the next run ranks theirs again.
+func (h *TellHandler) RefreshRankedFeeds() error {
+	active := h.DB.Model(&models.User{}).Select("id").
+		Where("is_verified = ? AND feed_viewed_at > ?", true, time.Now().Add(-rankedFeedActive))
+
+	if err := h.DB.Where("user_id NOT IN (?)", active).Delete(&models.FeedEntry{}).Error; err != nil {
+		return err
+	}
+
+	var userIDs []uuid.UUID
+	if err := active.Pluck("id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, userID := range userIDs {
+		if err := h.refreshRankedFeed(userID); err != nil {
+			log.Printf("❌ Could not rank feed for %s: %v", userID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed to refresh", failed, len(userIDs))
+	}
+	return nil
+}
+
+// markFeedViewed records that the viewer opened "For You", at most once per
+// feedViewedThrottle so browsing doesn't write on every page
+func (h *TellHandler) markFeedViewed(viewerID string) {
+	now := time.Now()
+	if err := h.DB.Model(&models.User{}).
+		Where("id = ? AND (feed_viewed_at IS NULL OR feed_viewed_at < ?)", viewerID, now.Add(-feedViewedThrottle)).
+		UpdateColumn("feed_viewed_at", now).Error; err != nil {
+		log.Printf("❌ Could not record feed view for %s: %v", viewerID, err)
+	}
+}
+
+// refreshRankedFeed swaps in a freshly scored feed for one user
+func (h *TellHandler) refreshRankedFeed(userID uuid.UUID) error {
+	now := time.Now()
+
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.FeedEntry{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(rankFeedSQL, map[string]interface{}{
+			"viewer":       userID,
+			"now":          now,
+			"since":        now.Add(-rankedFeedWindow),
+			"half_life":    rankedFeedHalfLife.Seconds(),
+			"follow_boost": rankedFeedFollowBoost,
+			"fof_boost":    rankedFeedFoFBoost,
+			"per_receiver": rankedFeedPerReceiver,
+			"size":         rankedFeedSize,
+		}).Error
+	})
+}
+
+// getRankedFeed serves a page of the viewer's materialized "For You" feed,
+// using "r<rank>" cursors. It reports false when the latest feed should be
+// served instead: the user's feed has not been computed yet, or the client is
+// already paging through a latest-feed fallback.
+func (h *TellHandler) getRankedFeed(c *fiber.Ctx, viewerID string, limit int) (bool, error) {
+	afterRank := 0
+	if cursor := c.Query("cursor"); cursor != "" {
+		rank, ok := strings.CutPrefix(cursor, "r")
+		if !ok {
+			return false, nil
+		}
+		if _, err := fmt.Sscanf(rank, "%d", &afterRank); err != nil || afterRank < 0 {
+			return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+	}
+
+	var rows []feedRow
+	if err := h.DB.Model(&models.FeedEntry{}).
+		Select(`tells.*, feed_entries.rank,
+			CASE WHEN EXISTS (
+				SELECT 1 FROM follows WHERE follows.follower_id = feed_entries.user_id AND follows.following_id = tells.receiver_id
+			) THEN 0 ELSE 1 END AS priority, `+feedRowColumns).
+		Joins("INNER JOIN tells ON tells.id = feed_entries.tell_id AND tells.deleted_at IS NULL").
+		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+		Joins("INNER JOIN users ON users.id = tells.receiver_id").
+		Where("feed_entries.user_id = ? AND feed_entries.rank > ?", viewerID, afterRank).
+		Where("tells.receiver_id NOT IN (?)", blockedWith(h.DB, viewerID)). // Blocks made since the feed was ranked
+		Order("feed_entries.rank asc").
+		Limit(limit + 1).
+		Scan(&rows).Error; err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch feed"})
+	}
+
+	if len(rows) == 0 && afterRank == 0 {
+		return false, nil
+	}
+
+	var nextCursor *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := fmt.Sprintf("r%d", rows[len(rows)-1].Rank)
+		nextCursor = &next
+	}
+
+	feedItems, err := h.buildFeedItems(viewerID, rows)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch feed"})
+	}
+
+	return true, c.JSON(pageResponse(feedItems, nextCursor))
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"strings"
+
+	"prswjo/models"
+	"prswjo/notify"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// resolveMentions looks up the @usernames in text and returns the users
+// authorID may mention: not themselves, no block either way, and allowed by
+// the mentioned user's MentionPolicy. Anything else stays plain text.
+func resolveMentions(tx *gorm.DB, authorID uuid.UUID, text string) ([]models.Mention, error) {
+	usernames := utils.ExtractMentions(text)
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	var users []models.User
+	if err := tx.Select("id, username, mention_policy").
+		Where("LOWER(username) IN ? AND id != ?", lowered, authorID).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+
+	var blocked []models.Block
+	if err := tx.Where("(blocker_id IN ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id IN ?)",
+		userIDs, authorID, authorID, userIDs).Find(&blocked).Error; err != nil {
+		return nil, err
+	}
+	isBlocked := make(map[uuid.UUID]bool, len(blocked))
+	for _, b := range blocked {
+		isBlocked[b.BlockerID] = true
+		isBlocked[b.BlockedID] = true
+	}
+
+	// Users who follow the author, for the "following" policy
+	var followerIDs []uuid.UUID
+	if err := tx.Model(&models.Follow{}).
+		Where("follower_id IN ? AND following_id = ?", userIDs, authorID).
+		Pluck("follower_id", &followerIDs).Error; err != nil {
+		return nil, err
+	}
+	followsAuthor := make(map[uuid.UUID]bool, len(followerIDs))
+	for _, id := range followerIDs {
+		followsAuthor[id] = true
+	}
+
+	var mentions []models.Mention
+	for _, user := range users {
+		if isBlocked[user.ID] {
+			continue
+		}
+
+		switch user.MentionPolicy {
+		case models.MentionNobody:
+			continue
+		case models.MentionFollowing:
+			if !followsAuthor[user.ID] {
+				continue
+			}
+		}
+
+		mentions = append(mentions, models.Mention{UserID: user.ID, Username: user.Username})
+	}
+
+	return mentions, nil
+}
+
+// saveMentions stores resolved mentions against an answer or a reply
+func saveMentions(tx *gorm.DB, mentions []models.Mention, answerID, replyID *uuid.UUID) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	for i := range mentions {
+		mentions[i].AnswerID = answerID
+		mentions[i].ReplyID = replyID
+	}
+	return tx.Create(&mentions).Error
+}
+
+// notifyMentions tells mentioned users. The author is left out when
+// hideAuthor is set, e.g. for an anonymous sender's reply.
+func notifyMentions(n *notify.Service, mentions []models.Mention, authorID uuid.UUID, hideAuthor bool, tellID uuid.UUID) {
+	if len(mentions) == 0 {
+		return
+	}
+
+	author := fiber.Map{}
+	var actorID *uuid.UUID
+	if !hideAuthor {
+		actorID = &authorID
+
+		var user models.User
+		if err := n.DB.Select("id, username, full_name, avatar").First(&user, "id = ?", authorID).Error; err == nil {
+			author = fiber.Map{
+				"id":        user.ID,
+				"username":  user.Username,
+				"full_name": user.FullName,
+				"avatar":    user.Avatar,
+			}
+		}
+	}
+
+	for _, mention := range mentions {
+		n.Send(notify.Event{
+			UserID:   mention.UserID,
+			ActorID:  actorID,
+			Payload:  notify.MentionPayload{TellID: tellID, MentionID: mention.ID},
+			Realtime: fiber.Map{"tell_id": tellID, "user": author},
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"prswjo/models"
+	"prswjo/notify"
+	"prswjo/ws"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationHandler serves the notification center
+type NotificationHandler struct {
+	DB     *gorm.DB
+	Notify *notify.Service
+}
+
+func NewNotificationHandler(db *gorm.DB, notifier *notify.Service) *NotificationHandler {
+	return &NotificationHandler{DB: db, Notify: notifier}
+}
+
+// GetNotifications lists the current user's notifications, newest first.
+// ?unread=true leaves out the ones already read.
+func (h *NotificationHandler) GetNotifications(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	limit := parseLimit(c)
+
+	query := h.DB.Where("user_id = ?", userID).
+		Preload("Actor", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username, full_name, avatar")
+		})
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var notifications []models.Notification
+	if result := query.Order("created_at desc").Order("id desc").Limit(limit + 1).Find(&notifications); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch notifications"})
+	}
+
+	var nextCursor *string
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[len(notifications)-1]
+		next := encodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &next
+	}
+
+	for i := range notifications {
+		notifications[i].Data = json.RawMessage(notifications[i].Payload)
+	}
+
+	return c.JSON(pageResponse(notifications, nextCursor))
+}
+
+// GetUnreadCount returns how many notifications the current user hasn't read
+func (h *NotificationHandler) GetUnreadCount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var count int64
+	h.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count)
+
+	return c.JSON(fiber.Map{"count": count})
+}
+
+// MarkRead marks one notification as read
+func (h *NotificationHandler) MarkRead(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	notificationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+	}
+
+	result := h.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", notificationID, userID).
+		Where("read_at IS NULL").
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update notification"})
+	}
+
+	if result.RowsAffected == 0 {
+		var count int64
+		h.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", notificationID, userID).Count(&count)
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+		}
+	}
+
+	h.broadcastUnreadCount(userID)
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// MarkAllRead marks every notification of the current user as read
+func (h *NotificationHandler) MarkAllRead(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	result := h.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update notifications"})
+	}
+
+	h.broadcastUnreadCount(userID)
+	return c.JSON(fiber.Map{"success": true, "updated": result.RowsAffected})
+}
+
+// broadcastUnreadCount keeps the badge in the user's other tabs in sync
+func (h *NotificationHandler) broadcastUnreadCount(userID string) {
+	var count int64
+	h.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count)
+
+	ws.GlobalManager.SendMessage(userID, fiber.Map{
+		"type":  "notifications_read",
+		"count": count,
+	})
+}
+
+// preferencesResponse is the shape of the preferences endpoints
+func preferencesResponse(settings models.NotificationSettings, prefs map[notify.Type]notify.Channels) fiber.Map {
+	return fiber.Map{
+		"timezone": settings.Timezone,
+		"quiet_hours": fiber.Map{
+			"enabled": settings.QuietHoursEnabled,
+			"start":   settings.QuietHoursStart,
+			"end":     settings.QuietHoursEnd,
+		},
+		"digest_mode": settings.DigestMode,
+		"preferences": prefs,
+	}
+}
+
+// GetPreferences returns the current user's channels per notification type,
+// timezone, quiet hours and digest mode
+func (h *NotificationHandler) GetPreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	settings, err := h.Notify.Settings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+	prefs, err := h.Notify.Preferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+
+	return c.JSON(preferencesResponse(settings, prefs))
+}
+
+// UpdatePreferences changes any part of the current user's preferences.
+// Channels left out of the request keep their current value.
+func (h *NotificationHandler) UpdatePreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	type ChannelsInput struct {
+		InApp     *bool `json:"in_app"`
+		WebSocket *bool `json:"websocket"`
+		Email     *bool `json:"email"`
+		Push      *bool `json:"push"`
+	}
+	type PreferencesInput struct {
+		Timezone   *string `json:"timezone"`
+		QuietHours *struct {
+			Enabled *bool   `json:"enabled"`
+			Start   *string `json:"start"`
+			End     *string `json:"end"`
+		} `json:"quiet_hours"`
+		DigestMode  *string                       `json:"digest_mode"`
+		Preferences map[notify.Type]ChannelsInput `json:"preferences"`
+	}
+
+	var input PreferencesInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	settings, err := h.Notify.Settings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+	prefs, err := h.Notify.Preferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown timezone"})
+		}
+		settings.Timezone = *input.Timezone
+	}
+	if quiet := input.QuietHours; quiet != nil {
+		if quiet.Enabled != nil {
+			settings.QuietHoursEnabled = *quiet.Enabled
+		}
+		if quiet.Start != nil {
+			settings.QuietHoursStart = *quiet.Start
+		}
+		if quiet.End != nil {
+			settings.QuietHoursEnd = *quiet.End
+		}
+		_, startErr := notify.ParseClock(settings.QuietHoursStart)
+		_, endErr := notify.ParseClock(settings.QuietHoursEnd)
+		if startErr != nil || endErr != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Quiet hours must be HH:MM"})
+		}
+	}
+
+	if input.DigestMode != nil {
+		if !notify.ValidDigestMode(*input.DigestMode) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Digest mode must be immediate, hourly, daily or weekly"})
+		}
+		settings.DigestMode = *input.DigestMode
+	}
+
+	for t, update := range input.Preferences {
+		if !notify.ValidType(t) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown notification type: " + string(t)})
+		}
+		channels := prefs[t]
+		if update.InApp != nil {
+			channels.InApp = *update.InApp
+		}
+		if update.WebSocket != nil {
+			channels.WebSocket = *update.WebSocket
+		}
+		if update.Email != nil {
+			channels.Email = *update.Email
+		}
+		if update.Push != nil {
+			channels.Push = *update.Push
+		}
+		prefs[t] = channels
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&settings).Error; err != nil {
+			return err
+		}
+		for t := range input.Preferences {
+			channels := prefs[t]
+			if err := tx.Save(&models.NotificationPreference{
+				UserID:    userID,
+				Type:      string(t),
+				InApp:     channels.InApp,
+				WebSocket: channels.WebSocket,
+				Email:     channels.Email,
+				Push:      channels.Push,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save preferences"})
+	}
+
+	return c.JSON(preferencesResponse(settings, prefs))
+}
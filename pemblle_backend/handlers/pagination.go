@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"prswjo/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 50
+)
+
+// pageCursor marks the last item of a page; clients pass it back opaquely to get the next one
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &pageCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// feedCursor marks a position in the public feed: bucket priority, then answer time and tell ID
+type feedCursor struct {
+	Priority   int
+	AnsweredAt time.Time
+	ID         uuid.UUID
+}
+
+func encodeFeedCursor(priority int, answeredAt time.Time, id uuid.UUID) string {
+	return fmt.Sprintf("%d.%s", priority, encodeCursor(answeredAt, id))
+}
+
+func decodeFeedCursor(cursor string) (*feedCursor, error) {
+	priority, rest, ok := strings.Cut(cursor, ".")
+	if !ok || (priority != "0" && priority != "1") {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	pos, err := decodeCursor(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &feedCursor{Priority: int(priority[0] - '0'), AnsweredAt: pos.CreatedAt, ID: pos.ID}, nil
+}
+
+// userSearchCursor marks a position in ranked user search results
+type userSearchCursor struct {
+	MatchRank int
+	Score     float64
+	ID        uuid.UUID
+}
+
+func encodeUserSearchCursor(matchRank int, score float64, id uuid.UUID) string {
+	raw := fmt.Sprintf("%d|%s|%s", matchRank, strconv.FormatFloat(score, 'g', -1, 64), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUserSearchCursor(cursor string) (*userSearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	matchRank, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &userSearchCursor{MatchRank: matchRank, Score: score, ID: id}, nil
+}
+
+// parseLimit reads the limit query param, clamped to [1, maxPageSize]
+func parseLimit(c *fiber.Ctx) int {
+	var limit int
+	if _, err := fmt.Sscanf(c.Query("limit"), "%d", &limit); err != nil || limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// pageResponse is the envelope shared by every cursor-paginated listing
+func pageResponse(items interface{}, nextCursor *string) fiber.Map {
+	return fiber.Map{
+		"items":       items,
+		"next_cursor": nextCursor,
+	}
+}
+
+// tellPage holds cursor pagination and sort options for tell listings
+type tellPage struct {
+	Limit  int
+	Oldest bool
+	After  *pageCursor
+}
+
+// parseTellPage reads limit, sort (newest|oldest) and cursor from the query string
+func parseTellPage(c *fiber.Ctx) (tellPage, error) {
+	page := tellPage{Limit: parseLimit(c)}
+
+	switch c.Query("sort", "newest") {
+	case "newest":
+	case "oldest":
+		page.Oldest = true
+	default:
+		return page, fmt.Errorf("invalid sort")
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return page, fmt.Errorf("invalid cursor")
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// apply adds keyset conditions, ordering and limit on tells.created_at/tells.id.
+// One extra row is fetched so trim can tell whether another page exists.
+func (p tellPage) apply(query *gorm.DB) *gorm.DB {
+	if p.Oldest {
+		if p.After != nil {
+			query = query.Where("(tells.created_at, tells.id) > (?, ?)", p.After.CreatedAt, p.After.ID)
+		}
+		query = query.Order("tells.created_at asc").Order("tells.id asc")
+	} else {
+		if p.After != nil {
+			query = query.Where("(tells.created_at, tells.id) < (?, ?)", p.After.CreatedAt, p.After.ID)
+		}
+		query = query.Order("tells.created_at desc").Order("tells.id desc")
+	}
+
+	return query.Limit(p.Limit + 1)
+}
+
+// trim drops the look-ahead row and returns the cursor for the next page, if any
+func (p tellPage) trim(tells []models.Tell) ([]models.Tell, *string) {
+	if len(tells) <= p.Limit {
+		return tells, nil
+	}
+
+	tells = tells[:p.Limit]
+	last := tells[len(tells)-1]
+	next := encodeCursor(last.CreatedAt, last.ID)
+	return tells, &next
+}
+
+// parseDateParam accepts either a full RFC 3339 timestamp or a plain YYYY-MM-DD date
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// applyTellFilters narrows a tell query by status (answered|unanswered),
+// anonymous (true|false) and a from/to creation date range
+func applyTellFilters(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	switch c.Query("status") {
+	case "":
+	case "answered":
+		query = query.Where("EXISTS (SELECT 1 FROM answers WHERE answers.tell_id = tells.id)")
+	case "unanswered":
+		query = query.Where("NOT EXISTS (SELECT 1 FROM answers WHERE answers.tell_id = tells.id)")
+	default:
+		return nil, fmt.Errorf("invalid status")
+	}
+
+	switch c.Query("anonymous") {
+	case "":
+	case "true":
+		query = query.Where("tells.is_anonymous = ?", true)
+	case "false":
+		query = query.Where("tells.is_anonymous = ?", false)
+	default:
+		return nil, fmt.Errorf("invalid anonymous filter")
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseDateParam(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date")
+		}
+		query = query.Where("tells.created_at >= ?", t)
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := parseDateParam(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date")
+		}
+		// A plain date includes the whole day
+		if len(to) == len("2006-01-02") {
+			t = t.Add(24 * time.Hour)
+		}
+		query = query.Where("tells.created_at < ?", t)
+	}
+
+	return query, nil
+}
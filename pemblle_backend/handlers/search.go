@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// searchIndexBatch is how many unindexed answers IndexAnswers handles per run
+const searchIndexBatch = 500
+
+// Snippet markers are control characters so user content can be HTML-escaped
+// before the matches are wrapped in <mark>
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// refreshSearchVector rebuilds an answer's search document from the tell, the
+// answer and its replies. Each part is indexed with the configuration for its
+// detected language, plus a "simple" copy so exact words always match.
+func refreshSearchVector(tx *gorm.DB, answerID uuid.UUID) error {
+	var answer models.Answer
+	if err := tx.Select("id, tell_id, content").First(&answer, "id = ?", answerID).Error; err != nil {
+		return err
+	}
+
+	var tell models.Tell
+	if err := tx.Unscoped().Select("id, content").First(&tell, "id = ?", answer.TellID).Error; err != nil {
+		return err
+	}
+
+	var replies []string
+	if err := tx.Model(&models.Reply{}).Where("answer_id = ?", answerID).Order("created_at asc").Pluck("content", &replies).Error; err != nil {
+		return err
+	}
+	replyText := strings.Join(replies, "\n")
+
+	return tx.Exec(`UPDATE answers SET search_vector =
+		setweight(to_tsvector(CAST(? AS regconfig), ?), 'A') ||
+		setweight(to_tsvector(CAST(? AS regconfig), ?), 'B') ||
+		setweight(to_tsvector(CAST(? AS regconfig), ?), 'C') ||
+		setweight(to_tsvector('simple', ?), 'D')
+		WHERE id = ?`,
+		utils.SearchConfig(answer.Content), answer.Content,
+		utils.SearchConfig(tell.Content), tell.Content,
+		utils.SearchConfig(replyText), replyText,
+		strings.Join([]string{answer.Content, tell.Content, replyText}, "\n"),
+		answerID,
+	).Error
+}
+
+// IndexAnswers fills in search documents for answers that don't have one yet,
+// i.e. answers written before search existed
+func (h *TellHandler) IndexAnswers() error {
+	var answerIDs []uuid.UUID
+	if err := h.DB.Model(&models.Answer{}).Where("search_vector IS NULL").
+		Limit(searchIndexBatch).Pluck("id", &answerIDs).Error; err != nil {
+		return err
+	}
+
+	// One answer that can't be indexed must not hold up the rest
+	failed := 0
+	for _, answerID := range answerIDs {
+		if err := refreshSearchVector(h.DB, answerID); err != nil {
+			log.Printf("❌ Could not index answer %s: %v", answerID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d answers failed to index", failed, len(answerIDs))
+	}
+	return nil
+}
+
+// SearchResult is a feed item matching a search, with highlighted snippets
+type SearchResult struct {
+	FeedItem
+	Score      float64 `json:"score"`
+	Highlights struct {
+		Tell   string `json:"tell"`
+		Answer string `json:"answer"`
+	} `json:"highlights"`
+}
+
+// searchRow is a feedRow plus the rank and raw snippets of a search match
+type searchRow struct {
+	models.Tell
+	AnsweredAt       time.Time
+	ReceiverUsername string
+	ReceiverFullName string
+	ReceiverAvatar   string
+	Score            float64
+	TellSnippet      string
+	AnswerSnippet    string
+}
+
+// Search runs a full-text search over public Q&A (tell, answer and replies).
+// Filters: user (receiver username) and a from/to answer date range.
+// Results are ranked, so the cursor is an opaque "o<offset>".
+func (h *TellHandler) Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Query is required"})
+	}
+
+	limit := parseLimit(c)
+
+	offset := 0
+	if cursor := c.Query("cursor"); cursor != "" {
+		n, ok := strings.CutPrefix(cursor, "o")
+		var err error
+		if offset, err = strconv.Atoi(n); !ok || err != nil || offset < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+	}
+
+	config := utils.SearchConfig(q)
+	headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10", snippetStart, snippetStop)
+
+	query := h.DB.Model(&models.Tell{}).
+		Select("tells.*, "+feedRowColumns+`,
+			ts_rank_cd(answers.search_vector, search.query) AS score,
+			ts_headline(CAST(? AS regconfig), tells.content, search.query, ?) AS tell_snippet,
+			ts_headline(CAST(? AS regconfig), answers.content, search.query, ?) AS answer_snippet`,
+			config, headlineOptions, config, headlineOptions).
+		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+		Joins("INNER JOIN users ON users.id = tells.receiver_id").
+		Joins("CROSS JOIN (SELECT websearch_to_tsquery(CAST(? AS regconfig), ?) || websearch_to_tsquery('simple', ?) AS query) search", config, q, q).
+		Where("answers.search_vector @@ search.query")
+
+	if username := c.Query("user"); username != "" {
+		query = query.Where("LOWER(users.username) = ?", strings.ToLower(username))
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseDateParam(from)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from date"})
+		}
+		query = query.Where("answers.created_at >= ?", t)
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := parseDateParam(to)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to date"})
+		}
+		// A plain date includes the whole day
+		if len(to) == len("2006-01-02") {
+			t = t.Add(24 * time.Hour)
+		}
+		query = query.Where("answers.created_at < ?", t)
+	}
+
+	var rows []searchRow
+	if err := query.Order("score desc").Order("answers.created_at desc").Order("tells.id desc").
+		Offset(offset).Limit(limit + 1).Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not search"})
+	}
+
+	var nextCursor *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := fmt.Sprintf("o%d", offset+limit)
+		nextCursor = &next
+	}
+
+	feed := make([]feedRow, len(rows))
+	for i, row := range rows {
+		feed[i] = feedRow{
+			Tell:             row.Tell,
+			Priority:         1,
+			AnsweredAt:       row.AnsweredAt,
+			ReceiverUsername: row.ReceiverUsername,
+			ReceiverFullName: row.ReceiverFullName,
+			ReceiverAvatar:   row.ReceiverAvatar,
+		}
+	}
+
+	// buildFeedItems hides anonymous senders, on the tell and on their replies
+	items, err := h.buildFeedItems(viewerID(c), feed)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not search"})
+	}
+
+	results := make([]SearchResult, len(items))
+	for i, item := range items {
+		results[i] = SearchResult{FeedItem: item, Score: rows[i].Score}
+		results[i].Highlights.Tell = highlightSnippet(rows[i].TellSnippet)
+		results[i].Highlights.Answer = highlightSnippet(rows[i].AnswerSnippet)
+	}
+
+	return c.JSON(pageResponse(results, nextCursor))
+}
+
+// highlightSnippet escapes a ts_headline snippet and turns its markers into <mark> tags
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetStop, "</mark>")
+}
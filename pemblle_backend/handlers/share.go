@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"prswjo/cards"
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ShareHandler serves link-preview pages and oEmbed for profiles and answers
+type ShareHandler struct {
+	DB *gorm.DB
+}
+
+func NewShareHandler(db *gorm.DB) *ShareHandler {
+	return &ShareHandler{DB: db}
+}
+
+// shareDescriptionLength caps og:description
+const shareDescriptionLength = 200
+
+// shareStrings are the localized texts used in link previews
+type shareStrings struct {
+	Locale        string // og:locale
+	RTL           bool
+	AnswerTitle   string // name, question
+	ProfileInvite string // name, site name
+	Redirecting   string
+}
+
+var shareLanguages = map[string]shareStrings{
+	"en": {
+		Locale:        "en_US",
+		AnswerTitle:   "%s answered: “%s”",
+		ProfileInvite: "Send %s an anonymous message on %s",
+		Redirecting:   "Redirecting…",
+	},
+	"ar": {
+		Locale:        "ar_AR",
+		RTL:           true,
+		AnswerTitle:   "أجاب %s: «%s»",
+		ProfileInvite: "أرسل رسالة مجهولة إلى %s على %s",
+		Redirecting:   "جارٍ التحويل…",
+	},
+	"ku": {
+		Locale:        "ckb_IQ",
+		RTL:           true,
+		AnswerTitle:   "%s وەڵامی دایەوە: «%s»",
+		ProfileInvite: "نامەیەکی نەناسراو بۆ %s بنێرە لە %s",
+		Redirecting:   "دەگوازرێتەوە…",
+	},
+}
+
+// shareLanguage picks ?lang= or the best Accept-Language match, defaulting to English
+func shareLanguage(c *fiber.Ctx) (string, shareStrings) {
+	lang := c.Query("lang")
+	if _, ok := shareLanguages[lang]; !ok {
+		lang = c.AcceptsLanguages("en", "ar", "ku")
+	}
+	if _, ok := shareLanguages[lang]; !ok {
+		lang = "en"
+	}
+	return lang, shareLanguages[lang]
+}
+
+// sharePage is everything rendered into a preview page
+type sharePage struct {
+	Lang        string
+	Strings     shareStrings
+	Title       string
+	Description string
+	Type        string // og:type
+	URL         string // Where people are sent: the page in the web app
+	Image       string
+	LargeImage  bool
+	OEmbedURL   string
+	SiteName    string
+}
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}"{{if .Strings.RTL}} dir="rtl"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta name="description" content="{{.Description}}">
+<link rel="canonical" href="{{.URL}}">
+<meta property="og:site_name" content="{{.SiteName}}">
+<meta property="og:type" content="{{.Type}}">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta property="og:url" content="{{.URL}}">
+<meta property="og:locale" content="{{.Strings.Locale}}">
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+{{- if .LargeImage}}
+<meta property="og:image:width" content="1200">
+<meta property="og:image:height" content="630">
+{{- end}}
+<meta name="twitter:image" content="{{.Image}}">
+{{- end}}
+<meta name="twitter:card" content="{{if .LargeImage}}summary_large_image{{else}}summary{{end}}">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- if .OEmbedURL}}
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+{{- end}}
+<meta http-equiv="refresh" content="0; url={{.URL}}">
+</head>
+<body>
+<p><a href="{{.URL}}">{{.Strings.Redirecting}}</a></p>
+</body>
+</html>
+`))
+
+func (h *ShareHandler) renderPage(c *fiber.Ctx, page sharePage) error {
+	page.SiteName = utils.SiteName()
+
+	var buf bytes.Buffer
+	if err := sharePageTemplate.Execute(&buf, page); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Could not render page")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=600")
+	c.Set(fiber.HeaderVary, fiber.HeaderAcceptLanguage)
+	return c.Send(buf.Bytes())
+}
+
+// shareAnswer is a public answer with the tell and receiver needed for previews
+type shareAnswer struct {
+	Answer   models.Answer
+	Tell     models.Tell
+	Receiver models.User
+}
+
+// loadShareAnswer finds a public answer. Deleted tells are left out by the
+// soft-delete scope, so their previews go away with them.
+func (h *ShareHandler) loadShareAnswer(answerID string) (*shareAnswer, error) {
+	var shared shareAnswer
+	if err := h.DB.First(&shared.Answer, "id = ?", answerID).Error; err != nil {
+		return nil, err
+	}
+	if err := h.DB.First(&shared.Tell, "id = ?", shared.Answer.TellID).Error; err != nil {
+		return nil, err
+	}
+	if err := h.DB.Select("id, username, full_name, avatar").First(&shared.Receiver, "id = ?", shared.Tell.ReceiverID).Error; err != nil {
+		return nil, err
+	}
+	return &shared, nil
+}
+
+// displayName is a user's full name, or their username when they have none
+func displayName(user models.User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Username
+}
+
+// truncateText shortens text to max runes on one line
+func truncateText(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
+
+// absoluteURL turns a path served by this API (like an avatar) into a full URL
+func absoluteURL(c *fiber.Ctx, path string) string {
+	if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return c.BaseURL() + path
+}
+
+// GetAnswerPage serves an answer's link-preview page, sending people on to the web app
+func (h *ShareHandler) GetAnswerPage(c *fiber.Ctx) error {
+	lang, strs := shareLanguage(c)
+
+	shared, err := h.loadShareAnswer(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Not found")
+	}
+
+	answerURL := utils.FrontendURL() + "/u/" + url.PathEscape(shared.Receiver.Username) + "#" + shared.Tell.ID.String()
+	shareURL := c.BaseURL() + "/api/share/answers/" + shared.Answer.ID.String()
+
+	return h.renderPage(c, sharePage{
+		Lang:        lang,
+		Strings:     strs,
+		Title:       fmt.Sprintf(strs.AnswerTitle, displayName(shared.Receiver), truncateText(shared.Tell.Content, 80)),
+		Description: truncateText(shared.Answer.Content, shareDescriptionLength),
+		Type:        "article",
+		URL:         answerURL,
+		Image:       c.BaseURL() + "/api/public/answers/" + shared.Answer.ID.String() + "/card.png",
+		LargeImage:  true,
+		OEmbedURL:   c.BaseURL() + "/api/oembed?format=json&url=" + url.QueryEscape(shareURL),
+	})
+}
+
+// GetProfilePage serves a profile's link-preview page
+func (h *ShareHandler) GetProfilePage(c *fiber.Ctx) error {
+	lang, strs := shareLanguage(c)
+
+	var user models.User
+	if result := h.DB.Where("username = ? AND is_verified = ?", c.Params("username"), true).First(&user); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Not found")
+	}
+
+	name := displayName(user)
+	description := truncateText(user.Bio, shareDescriptionLength)
+	if description == "" {
+		description = fmt.Sprintf(strs.ProfileInvite, name, utils.SiteName())
+	}
+
+	return h.renderPage(c, sharePage{
+		Lang:        lang,
+		Strings:     strs,
+		Title:       fmt.Sprintf("%s (@%s)", name, user.Username),
+		Description: description,
+		Type:        "profile",
+		URL:         utils.FrontendURL() + "/u/" + url.PathEscape(user.Username),
+		Image:       absoluteURL(c, user.Avatar),
+	})
+}
+
+// answerURLPattern finds the answer ID in a share page URL (/api/share/answers/:id)
+var answerURLPattern = regexp.MustCompile(`/answers/([0-9a-fA-F-]{36})(?:[/?#]|$)`)
+
+// GetOEmbed implements the oEmbed endpoint (https://oembed.com) for answer share URLs
+func (h *ShareHandler) GetOEmbed(c *fiber.Ctx) error {
+	if format := c.Query("format", "json"); format != "json" {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "Only json is supported"})
+	}
+
+	match := answerURLPattern.FindStringSubmatch(c.Query("url"))
+	if match == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unsupported URL"})
+	}
+
+	shared, err := h.loadShareAnswer(match[1])
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	// The embed keeps the card's aspect ratio, shrunk to fit maxwidth and maxheight
+	width := cards.Width / 2
+	var maxWidth, maxHeight int
+	if _, err := fmt.Sscanf(c.Query("maxwidth"), "%d", &maxWidth); err == nil && maxWidth > 0 && maxWidth < width {
+		width = maxWidth
+	}
+	height := width * cards.Height / cards.Width
+	if _, err := fmt.Sscanf(c.Query("maxheight"), "%d", &maxHeight); err == nil && maxHeight > 0 && maxHeight < height {
+		height = maxHeight
+		width = height * cards.Width / cards.Height
+	}
+
+	name := displayName(shared.Receiver)
+	profileURL := utils.FrontendURL() + "/u/" + url.PathEscape(shared.Receiver.Username)
+	answerURL := profileURL + "#" + shared.Tell.ID.String()
+
+	// Only the question, answer and receiver go in the embed; never the sender
+	var embed bytes.Buffer
+	if err := oembedTemplate.Execute(&embed, fiber.Map{
+		"Question": shared.Tell.Content,
+		"Answer":   shared.Answer.Content,
+		"Name":     name,
+		"URL":      answerURL,
+		"Width":    width,
+		"Height":   height,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not build embed"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=600")
+	return c.JSON(fiber.Map{
+		"version":          "1.0",
+		"type":             "rich",
+		"title":            truncateText(shared.Tell.Content, 80),
+		"author_name":      name,
+		"author_url":       profileURL,
+		"provider_name":    utils.SiteName(),
+		"provider_url":     utils.FrontendURL(),
+		"cache_age":        600,
+		"thumbnail_url":    c.BaseURL() + "/api/public/answers/" + shared.Answer.ID.String() + "/card.png",
+		"thumbnail_width":  cards.Width,
+		"thumbnail_height": cards.Height,
+		"html":             embed.String(),
+		"width":            width,
+		"height":           height,
+	})
+}
+
+var oembedTemplate = template.Must(template.New("oembed").Parse(
+	`<blockquote class="pemblle-answer" dir="auto" style="box-sizing:border-box;max-width:{{.Width}}px;height:{{.Height}}px;overflow:auto">` +
+		`<p>{{.Question}}</p><p><strong>{{.Answer}}</strong></p>` +
+		`<footer>— <a href="{{.URL}}">{{.Name}}</a></footer></blockquote>`))
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"prswjo/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Tuning for who-to-follow suggestions
+const (
+	suggestionsTTL          = time.Hour          // Cached suggestions are recomputed after this
+	suggestionsSize         = 50                 // Suggestions cached per user
+	suggestionsAnswerWindow = 7 * 24 * time.Hour // "Recently answered" lookback
+	suggestionFoFWeight     = 2.0                // Per person you follow who follows them
+	suggestionMutualWeight  = 1.0                // Per follower of yours who follows them
+	suggestionFollowsYou    = 3.0                // They already follow you
+	suggestionAnswerWeight  = 0.5                // Multiplied by ln(1 + recent answers)
+)
+
+// suggestionsSQL gathers candidates from the follow graph and recent answerers,
+// leaving out the viewer, people they already follow and blocks either way.
+// Anonymous follows only count as the viewer's own; anywhere else they would
+// show who is behind them.
+const suggestionsSQL = `
+WITH following AS (
+	SELECT following_id AS id FROM follows WHERE follower_id = @viewer
+), followers AS (
+	SELECT follower_id AS id FROM follows WHERE following_id = @viewer AND is_anonymous = false
+), blocked AS (
+	SELECT blocked_id AS id FROM blocks WHERE blocker_id = @viewer
+	UNION SELECT blocker_id FROM blocks WHERE blocked_id = @viewer
+), fof AS (
+	SELECT following_id AS id, COUNT(*) AS n FROM follows
+	WHERE follower_id IN (SELECT id FROM following) AND is_anonymous = false GROUP BY following_id
+), mutual AS (
+	SELECT following_id AS id, COUNT(*) AS n FROM follows
+	WHERE follower_id IN (SELECT id FROM followers) AND is_anonymous = false GROUP BY following_id
+), answerers AS (
+	SELECT tells.receiver_id AS id, COUNT(*) AS n FROM answers
+	INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL
+	WHERE answers.created_at > @since GROUP BY tells.receiver_id
+), candidates AS (
+	SELECT id FROM fof UNION SELECT id FROM mutual UNION SELECT id FROM followers UNION SELECT id FROM answerers
+)
+SELECT candidates.id AS suggested_id,
+	COALESCE(fof.n, 0) AS friends_of_friends,
+	COALESCE(mutual.n, 0) AS mutual_followers,
+	candidates.id IN (SELECT id FROM followers) AS follows_you,
+	COALESCE(answerers.n, 0) AS recent_answers,
+	@fof_weight * COALESCE(fof.n, 0)
+		+ @mutual_weight * COALESCE(mutual.n, 0)
+		+ CASE WHEN candidates.id IN (SELECT id FROM followers) THEN @follows_you ELSE 0 END
+		+ @answer_weight * LN(1 + COALESCE(answerers.n, 0)) AS score
+FROM candidates
+INNER JOIN users ON users.id = candidates.id AND users.is_verified = true
+LEFT JOIN fof ON fof.id = candidates.id
+LEFT JOIN mutual ON mutual.id = candidates.id
+LEFT JOIN answerers ON answerers.id = candidates.id
+WHERE candidates.id <> @viewer
+	AND candidates.id NOT IN (SELECT id FROM following)
+	AND candidates.id NOT IN (SELECT id FROM blocked)
+ORDER BY score DESC, candidates.id
+LIMIT @size`
+
+// SuggestionItem is a suggested user with the reason they were suggested
+type SuggestionItem struct {
+	models.Suggestion
+	User        models.User `json:"user"`
+	Explanation string      `json:"explanation"`
+}
+
+// GetSuggestions returns who-to-follow suggestions for the current user,
+// served from the per-user cache while it is fresh
+func (h *UserHandler) GetSuggestions(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	limit := parseLimit(c)
+
+	// The timestamp, not the rows, says whether the cache is fresh: someone
+	// with nobody to suggest would otherwise be recomputed on every request
+	var fresh int64
+	if err := h.DB.Model(&models.User{}).
+		Where("id = ? AND suggested_at > ?", userID, time.Now().Add(-suggestionsTTL)).
+		Count(&fresh).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch suggestions"})
+	}
+
+	var suggestions []models.Suggestion
+	if fresh > 0 {
+		if result := h.DB.Where("user_id = ?", userID).
+			Order("score desc").Order("suggested_id asc").Limit(limit).
+			Find(&suggestions); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch suggestions"})
+		}
+	} else {
+		if suggestions, err = h.refreshSuggestions(userID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch suggestions"})
+		}
+		if len(suggestions) > limit {
+			suggestions = suggestions[:limit]
+		}
+	}
+
+	userIDs := make([]uuid.UUID, len(suggestions))
+	for i, s := range suggestions {
+		userIDs[i] = s.SuggestedID
+	}
+
+	var users []models.User
+	if len(userIDs) > 0 {
+		if result := h.DB.Where("id IN ?", userIDs).Find(&users); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch suggestions"})
+		}
+	}
+	byID := make(map[uuid.UUID]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	items := make([]SuggestionItem, 0, len(suggestions))
+	for _, s := range suggestions {
+		user, ok := byID[s.SuggestedID]
+		if !ok {
+			continue
+		}
+		items = append(items, SuggestionItem{Suggestion: s, User: user, Explanation: explainSuggestion(s)})
+	}
+
+	return c.JSON(items)
+}
+
+// refreshSuggestions recomputes and caches a user's suggestions, stamping
+// User.SuggestedAt so an empty result is cached too
+func (h *UserHandler) refreshSuggestions(userID uuid.UUID) ([]models.Suggestion, error) {
+	now := time.Now()
+
+	var suggestions []models.Suggestion
+	if err := h.DB.Raw(suggestionsSQL, map[string]interface{}{
+		"viewer":        userID,
+		"since":         now.Add(-suggestionsAnswerWindow),
+		"fof_weight":    suggestionFoFWeight,
+		"mutual_weight": suggestionMutualWeight,
+		"follows_you":   suggestionFollowsYou,
+		"answer_weight": suggestionAnswerWeight,
+		"size":          suggestionsSize,
+	}).Scan(&suggestions).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range suggestions {
+		suggestions[i].UserID = userID
+		suggestions[i].ComputedAt = now
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Suggestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("suggested_at", now).Error; err != nil {
+			return err
+		}
+		if len(suggestions) == 0 {
+			return nil
+		}
+		return tx.Create(&suggestions).Error
+	})
+	return suggestions, err
+}
+
+// invalidateSuggestions drops cached suggestions so they are rebuilt on next
+// request. The timestamp goes first, so a read in between recomputes rather
+// than finding a fresh cache with no rows.
+func invalidateSuggestions(db *gorm.DB, userIDs ...uuid.UUID) error {
+	if err := db.Model(&models.User{}).Where("id IN ?", userIDs).UpdateColumn("suggested_at", nil).Error; err != nil {
+		return err
+	}
+	return db.Where("user_id IN ?", userIDs).Delete(&models.Suggestion{}).Error
+}
+
+// explainSuggestion describes the strongest reason behind a suggestion
+func explainSuggestion(s models.Suggestion) string {
+	switch {
+	case s.FriendsOfFriends > 0:
+		return fmt.Sprintf("followed by %s you follow", pluralize(s.FriendsOfFriends, "person", "people"))
+	case s.FollowsYou:
+		return "follows you"
+	case s.MutualFollowers > 0:
+		return fmt.Sprintf("followed by %d of your followers", s.MutualFollowers)
+	case s.RecentAnswers > 0:
+		return fmt.Sprintf("answered %s this week", pluralize(s.RecentAnswers, "tell", "tells"))
+	default:
+		return ""
+	}
+}
+
+// pluralize formats a count with the singular or plural noun
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
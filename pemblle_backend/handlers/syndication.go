@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// syndicationSize is how many answers a user's Atom/RSS feed carries
+const syndicationSize = 20
+
+// feedTitleLength caps entry titles, which are cut from the tell
+const feedTitleLength = 80
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// GetUserAtomFeed serves a user's public answers as an Atom feed
+func (h *TellHandler) GetUserAtomFeed(c *fiber.Ctx) error {
+	return h.userSyndicationFeed(c, "atom")
+}
+
+// GetUserRSSFeed serves a user's public answers as an RSS 2.0 feed
+func (h *TellHandler) GetUserRSSFeed(c *fiber.Ctx) error {
+	return h.userSyndicationFeed(c, "rss")
+}
+
+// userSyndicationFeed renders the newest answers on a profile, the same
+// tells GetUserTells lists, honoring If-None-Match and If-Modified-Since
+func (h *TellHandler) userSyndicationFeed(c *fiber.Ctx, format string) error {
+	var user models.User
+	if result := h.DB.Where("username = ?", c.Params("username")).First(&user); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	var tells []models.Tell
+	if result := h.DB.Where("receiver_id = ?", user.ID).
+		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+		Preload("Answer").
+		Order("answers.created_at desc").Order("tells.id desc").
+		Limit(syndicationSize).
+		Find(&tells); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tells"})
+	}
+
+	// The feed changes when an answer is added, edited or removed, or the profile changes
+	updated := user.UpdatedAt
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%d", format, user.UpdatedAt.UTC().Format(time.RFC3339Nano), len(tells))
+	for _, tell := range tells {
+		at := answerUpdatedAt(tell.Answer)
+		if at.After(updated) {
+			updated = at
+		}
+		fmt.Fprintf(hash, "|%s@%s", tell.Answer.ID, at.UTC().Format(time.RFC3339Nano))
+	}
+	updated = updated.UTC().Truncate(time.Second)
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, updated.Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		if etagMatches(match, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if since := c.Get(fiber.HeaderIfModifiedSince); since != "" {
+		if t, err := http.ParseTime(since); err == nil && !updated.After(t) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	profileURL := utils.FrontendURL() + "/u/" + user.Username
+	displayName := user.FullName
+	if displayName == "" {
+		displayName = user.Username
+	}
+	title := fmt.Sprintf("%s (@%s) on %s", displayName, user.Username, utils.SiteName())
+
+	var body interface{}
+	if format == "atom" {
+		feed := atomFeed{
+			ID:      "urn:uuid:" + user.ID.String(),
+			Title:   title,
+			Updated: updated.Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: profileURL, Rel: "alternate", Type: "text/html"},
+				{Href: c.BaseURL() + c.OriginalURL(), Rel: "self", Type: "application/atom+xml"},
+			},
+			Author: atomAuthor{Name: displayName, URI: profileURL},
+		}
+		for _, tell := range tells {
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:        "urn:uuid:" + tell.Answer.ID.String(),
+				Title:     feedEntryTitle(tell.Content),
+				Published: tell.Answer.CreatedAt.UTC().Format(time.RFC3339),
+				Updated:   answerUpdatedAt(tell.Answer).UTC().Format(time.RFC3339),
+				Link:      atomLink{Href: profileURL + "#" + tell.ID.String(), Rel: "alternate", Type: "text/html"},
+				Content:   atomContent{Type: "html", Body: feedEntryHTML(tell)},
+			})
+		}
+		body = feed
+		c.Set(fiber.HeaderContentType, "application/atom+xml; charset=utf-8")
+	} else {
+		feed := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:         title,
+				Link:          profileURL,
+				Description:   user.Bio,
+				LastBuildDate: updated.Format(time.RFC1123Z),
+			},
+		}
+		for _, tell := range tells {
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       feedEntryTitle(tell.Content),
+				Link:        profileURL + "#" + tell.ID.String(),
+				GUID:        rssGUID{Value: "urn:uuid:" + tell.Answer.ID.String()},
+				PubDate:     tell.Answer.CreatedAt.UTC().Format(time.RFC1123Z),
+				Description: feedEntryHTML(tell),
+			})
+		}
+		body = feed
+		c.Set(fiber.HeaderContentType, "application/rss+xml; charset=utf-8")
+	}
+
+	out, err := xml.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not build feed"})
+	}
+
+	return c.Send(append([]byte(xml.Header), out...))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag: "*", or
+// any tag in the comma-separated list by weak comparison (RFC 9110 13.1.2),
+// so W/"x" matches "x". A malformed list matches nothing.
+func etagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for header != "" {
+		if header[0] == ',' {
+			header = strings.TrimLeft(header[1:], " \t")
+			continue
+		}
+		tag := strings.TrimPrefix(header, "W/")
+		if !strings.HasPrefix(tag, `"`) {
+			return false
+		}
+		end := strings.IndexByte(tag[1:], '"')
+		if end < 0 {
+			return false
+		}
+		if tag[:end+2] == etag {
+			return true
+		}
+		header = strings.TrimLeft(tag[end+2:], " \t")
+	}
+	return false
+}
+
+// answerUpdatedAt is when an answer last changed
+func answerUpdatedAt(answer *models.Answer) time.Time {
+	if answer.EditedAt != nil {
+		return *answer.EditedAt
+	}
+	return answer.CreatedAt
+}
+
+// feedEntryTitle shortens a tell to a one-line entry title
+func feedEntryTitle(content string) string {
+	title := strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(title) <= feedTitleLength {
+		return title
+	}
+	return string([]rune(title)[:feedTitleLength-1]) + "…"
+}
+
+// feedEntryHTML renders the tell and its answer. Only the content is included,
+// never the sender, so anonymous tells stay anonymous in feed readers.
+func feedEntryHTML(tell models.Tell) string {
+	return fmt.Sprintf("<blockquote>%s</blockquote><p>%s</p>",
+		strings.ReplaceAll(html.EscapeString(tell.Content), "\n", "<br>"),
+		strings.ReplaceAll(html.EscapeString(tell.Answer.Content), "\n", "<br>"))
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`"xyz"`, false},
+		{`*`, true},
+		{` * `, true},
+		{`W/"abc"`, true}, // Weak comparison
+		{`"xyz", "abc"`, true},
+		{`"xyz","abc"`, true},
+		{`"xyz" ,	W/"abc"`, true},
+		{`"xyz", W/"other"`, false},
+		{`"a,b", "abc"`, true}, // Commas may appear inside a tag
+		{`"a,b"`, false},
+		{`abc`, false},      // Unquoted
+		{`"abc`, false},     // Unterminated
+		{`"xyz", *`, false}, // "*" only stands alone
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+
+	if !etagMatches(`"abc"`, `W/"abc"`) {
+		t.Error("a weak ETag should match its strong form")
+	}
+}
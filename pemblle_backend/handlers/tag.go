@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// trendingWindows are the sliding windows trending tags are computed for
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// trendingTagsSize is how many tags are kept per window
+const trendingTagsSize = 50
+
+// syncAnswerTags replaces an answer's hashtags with the ones found in texts
+func syncAnswerTags(tx *gorm.DB, answerID uuid.UUID, texts ...string) error {
+	if err := tx.Where("answer_id = ?", answerID).Delete(&models.AnswerTag{}).Error; err != nil {
+		return err
+	}
+
+	names := utils.ExtractHashtags(strings.Join(texts, "\n"))
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]models.Tag, len(names))
+	for i, name := range names {
+		tags[i] = models.Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+
+	// Existing tags were skipped by the insert, so look every ID up by name
+	var tagIDs []uuid.UUID
+	if err := tx.Model(&models.Tag{}).Where("name IN ?", names).Pluck("id", &tagIDs).Error; err != nil {
+		return err
+	}
+
+	links := make([]models.AnswerTag, len(tagIDs))
+	for i, tagID := range tagIDs {
+		links[i] = models.AnswerTag{AnswerID: answerID, TagID: tagID}
+	}
+	return tx.Create(&links).Error
+}
+
+// GetTagAnswers returns public answers tagged with :tag, newest first, cursor-paginated
+func (h *TellHandler) GetTagAnswers(c *fiber.Ctx) error {
+	tag, err := url.PathUnescape(c.Params("tag"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tag"})
+	}
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+
+	limit := parseLimit(c)
+
+	var after *pageCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		if after, err = decodeCursor(cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+	}
+
+	query := h.DB.Model(&models.Tell{}).
+		Select("tells.*, 1 AS priority, "+feedRowColumns).
+		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+		Joins("INNER JOIN users ON users.id = tells.receiver_id").
+		Joins("INNER JOIN answer_tags ON answer_tags.answer_id = answers.id").
+		Joins("INNER JOIN tags ON tags.id = answer_tags.tag_id").
+		Where("tags.name = ?", tag)
+
+	if after != nil {
+		query = query.Where("(answers.created_at, tells.id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var rows []feedRow
+	if err := query.Order("answers.created_at desc").Order("tells.id desc").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tag"})
+	}
+
+	var nextCursor *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		next := encodeCursor(last.AnsweredAt, last.ID)
+		nextCursor = &next
+	}
+
+	items, err := h.buildFeedItems(viewerID(c), rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tag"})
+	}
+
+	return c.JSON(pageResponse(items, nextCursor))
+}
+
+// GetTrendingTags returns the precomputed trending tags for ?window=1h|24h|7d
+func (h *TellHandler) GetTrendingTags(c *fiber.Ctx) error {
+	window := c.Query("window", "24h")
+	if _, ok := trendingWindows[window]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid window"})
+	}
+
+	var tags []models.TrendingTag
+	if result := h.DB.Where("period = ?", window).Order("rank asc").Find(&tags); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch trending tags"})
+	}
+
+	return c.JSON(fiber.Map{"window": window, "tags": tags})
+}
+
+// RefreshTrendingTags recounts the most used tags on answers inside each trending window
+func (h *TellHandler) RefreshTrendingTags() error {
+	now := time.Now()
+
+	for window, length := range trendingWindows {
+		var counts []models.TrendingTag
+		if err := h.DB.Table("answer_tags").
+			Select("tags.id AS tag_id, tags.name, COUNT(*) AS answer_count").
+			Joins("INNER JOIN tags ON tags.id = answer_tags.tag_id").
+			Joins("INNER JOIN answers ON answers.id = answer_tags.answer_id").
+			Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+			Where("answers.created_at > ?", now.Add(-length)).
+			Group("tags.id, tags.name").
+			Order("answer_count desc, MAX(answers.created_at) desc").
+			Limit(trendingTagsSize).
+			Scan(&counts).Error; err != nil {
+			return err
+		}
+
+		for i := range counts {
+			counts[i].Period = window
+			counts[i].Rank = i + 1
+			counts[i].ComputedAt = now
+		}
+
+		if err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("period = ?", window).Delete(&models.TrendingTag{}).Error; err != nil {
+				return err
+			}
+			if len(counts) == 0 {
+				return nil
+			}
+			return tx.Create(&counts).Error
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
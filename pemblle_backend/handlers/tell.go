@@ -2,21 +2,24 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"prswjo/models"
-	"prswjo/utils"
-	"prswjo/ws"
+	"prswjo/notify"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TellHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Notify *notify.Service
 }
 
-func NewTellHandler(db *gorm.DB) *TellHandler {
-	return &TellHandler{DB: db}
+func NewTellHandler(db *gorm.DB, notifier *notify.Service) *TellHandler {
+	return &TellHandler{DB: db, Notify: notifier}
 }
 
 func (h *TellHandler) CreateTell(c *fiber.Ctx) error {
@@ -41,6 +44,13 @@ func (h *TellHandler) CreateTell(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	senderID, err := uuid.Parse(userID)
 	if err == nil {
+		blocked, err := isBlockedBetween(h.DB, senderID, input.ReceiverID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check blocks"})
+		}
+		if blocked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can't send tells to this user"})
+		}
 		tell.SenderID = &senderID
 	}
 
@@ -48,19 +58,7 @@ func (h *TellHandler) CreateTell(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create tell"})
 	}
 
-	// Send notification
-	ws.GlobalManager.SendMessage(tell.ReceiverID.String(), fiber.Map{
-		"type": "new_tell",
-		"tell": tell,
-	})
-
-	// Send Email
-	go func() {
-		var receiver models.User
-		if result := h.DB.Select("email").First(&receiver, "id = ?", tell.ReceiverID); result.Error == nil && receiver.Email != "" {
-			utils.SendNewTellEmail(receiver.Email)
-		}
-	}()
+	h.notifyNewTell(tell)
 
 	return c.JSON(tell)
 }
@@ -99,30 +97,56 @@ func (h *TellHandler) CreatePublicTell(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create tell"})
 	}
 
-	// Send notification
-	ws.GlobalManager.SendMessage(tell.ReceiverID.String(), fiber.Map{
-		"type": "new_tell",
-		"tell": tell,
-	})
-
-	// Send Email
-	go func() {
-		if receiver.Email != "" {
-			utils.SendNewTellEmail(receiver.Email)
-		}
-	}()
+	h.notifyNewTell(tell)
 
 	return c.JSON(tell)
 }
 
+// notifyNewTell tells the receiver about a new tell, without revealing an anonymous sender
+func (h *TellHandler) notifyNewTell(tell models.Tell) {
+	var actorID *uuid.UUID
+	if !tell.IsAnonymous {
+		actorID = tell.SenderID
+	} else {
+		tell.SenderID = nil
+	}
+
+	h.Notify.Send(notify.Event{
+		UserID:   tell.ReceiverID,
+		ActorID:  actorID,
+		Payload:  notify.NewTellPayload{TellID: tell.ID, Preview: notify.Preview(tell.Content)},
+		Realtime: fiber.Map{"tell": tell},
+	})
+}
+
 func (h *TellHandler) GetTells(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
+	page, err := parseTellPage(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Archived tells are kept out of the inbox unless explicitly requested
+	query := h.DB.Where("receiver_id = ?", userID)
+	if c.Query("archived") == "true" {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+
+	query, err = applyTellFilters(c, query)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	var tells []models.Tell
-	if result := h.DB.Where("receiver_id = ?", userID).Preload("Receiver").Preload("Answer.Replies").Preload("Answer").Order("created_at desc").Find(&tells); result.Error != nil {
+	if result := page.apply(query).Preload("Receiver").Preload("Answer.Replies.Mentions").Preload("Answer.Mentions").Find(&tells); result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tells"})
 	}
 
+	tells, nextCursor := page.trim(tells)
+
 	// Hide SenderID if anonymous
 	for i := range tells {
 		if tells[i].IsAnonymous {
@@ -137,7 +161,7 @@ func (h *TellHandler) GetTells(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(tells)
+	return c.JSON(pageResponse(tells, nextCursor))
 }
 
 func (h *TellHandler) AnswerTell(c *fiber.Ctx) error {
@@ -163,30 +187,510 @@ func (h *TellHandler) AnswerTell(c *fiber.Ctx) error {
 		Content: input.Content,
 	}
 
-	if result := h.DB.Create(&answer); result.Error != nil {
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+		if err := syncAnswerTags(tx, answer.ID, tell.Content, answer.Content); err != nil {
+			return err
+		}
+		if err := refreshSearchVector(tx, answer.ID); err != nil {
+			return err
+		}
+
+		mentions, err := resolveMentions(tx, tell.ReceiverID, answer.Content)
+		if err != nil {
+			return err
+		}
+		answer.Mentions = mentions
+		return saveMentions(tx, answer.Mentions, &answer.ID, nil)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create answer"})
 	}
 
+	notifyMentions(h.Notify, answer.Mentions, tell.ReceiverID, false, tell.ID)
+
+	// Publish to followers on other servers
+	go publishAnswer(h.DB, tell, answer)
+
 	// Notify the original sender (if they exist)
 	if tell.SenderID != nil {
-		ws.GlobalManager.SendMessage(tell.SenderID.String(), fiber.Map{
-			"type":   "tell_answered",
-			"tell":   tell,
-			"answer": answer,
+		h.Notify.Send(notify.Event{
+			UserID:   *tell.SenderID,
+			ActorID:  &tell.ReceiverID,
+			Payload:  notify.AnsweredPayload{TellID: tell.ID, AnswerID: answer.ID, Preview: notify.Preview(answer.Content)},
+			Realtime: fiber.Map{"tell": tell, "answer": answer},
 		})
+	}
 
-		// Send Email
-		go func() {
-			var sender models.User
-			if result := h.DB.Select("email").First(&sender, "id = ?", tell.SenderID); result.Error == nil && sender.Email != "" {
-				utils.SendTellAnsweredEmail(sender.Email)
+	return c.JSON(answer)
+}
+
+// EditAnswer updates the receiver's answer, keeping the previous content as a revision
+func (h *TellHandler) EditAnswer(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+
+	type EditInput struct {
+		Content string `json:"content"`
+	}
+
+	var input EditInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if input.Content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Content is required"})
+	}
+
+	// Only the receiver of the tell may edit its answer
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("answers.id = ? AND tells.receiver_id = ?", answerID, userID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found or unauthorized"})
+	}
+
+	if answer.Content == input.Content {
+		return c.JSON(answer)
+	}
+
+	now := time.Now()
+	var newMentions []models.Mention
+	unchanged := false
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// The revision records the content this edit replaces. Locking the row
+		// makes a concurrent edit wait, then record this edit's content in turn.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&answer, "id = ?", answer.ID).Error; err != nil {
+			return err
+		}
+		if answer.Content == input.Content {
+			unchanged = true
+			return nil
+		}
+
+		revision := models.AnswerRevision{
+			AnswerID: answer.ID,
+			Content:  answer.Content,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&answer).Updates(map[string]interface{}{
+			"content":   input.Content,
+			"edited_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var tell models.Tell
+		if err := tx.Select("id, receiver_id, content").First(&tell, "id = ?", answer.TellID).Error; err != nil {
+			return err
+		}
+		if err := syncAnswerTags(tx, answer.ID, tell.Content, input.Content); err != nil {
+			return err
+		}
+		if err := refreshSearchVector(tx, answer.ID); err != nil {
+			return err
+		}
+
+		// Re-resolve mentions, notifying only users who were not mentioned before
+		var previous []uuid.UUID
+		if err := tx.Model(&models.Mention{}).Where("answer_id = ?", answer.ID).Pluck("user_id", &previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("answer_id = ?", answer.ID).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+
+		mentions, err := resolveMentions(tx, tell.ReceiverID, input.Content)
+		if err != nil {
+			return err
+		}
+		if err := saveMentions(tx, mentions, &answer.ID, nil); err != nil {
+			return err
+		}
+		answer.Mentions = mentions
+
+		alreadyMentioned := make(map[uuid.UUID]bool, len(previous))
+		for _, id := range previous {
+			alreadyMentioned[id] = true
+		}
+		for _, mention := range mentions {
+			if !alreadyMentioned[mention.UserID] {
+				newMentions = append(newMentions, mention)
 			}
-		}()
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update answer"})
+	}
+	if unchanged {
+		return c.JSON(answer)
 	}
 
+	answer.Content = input.Content
+	answer.EditedAt = &now
+
+	removeAnswerCards(answer.ID)
+
+	editorID, _ := uuid.Parse(userID)
+	notifyMentions(h.Notify, newMentions, editorID, false, answer.TellID)
+
 	return c.JSON(answer)
 }
 
+// GetAnswerRevisions returns the edit history of a public answer, newest first
+func (h *TellHandler) GetAnswerRevisions(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("answers.id = ?", answerID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	var revisions []models.AnswerRevision
+	if result := h.DB.Where("answer_id = ?", answer.ID).Order("created_at desc").Find(&revisions); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch revisions"})
+	}
+
+	return c.JSON(fiber.Map{
+		"answer":    answer,
+		"revisions": revisions,
+	})
+}
+
+// ToggleLike likes an answer, or removes the like if the user already liked it
+func (h *TellHandler) ToggleLike(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+	userUUID, _ := uuid.Parse(userID)
+
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("answers.id = ?", answerID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	var liked bool
+	var like models.Like
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Try to unlike first; if nothing was removed this is a new like
+		result := tx.Where("answer_id = ? AND user_id = ?", answer.ID, userUUID).Delete(&models.Like{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return tx.Model(&answer).UpdateColumn("like_count", gorm.Expr("GREATEST(like_count - 1, 0)")).Error
+		}
+
+		like = models.Like{AnswerID: answer.ID, UserID: userUUID}
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&like)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Liked concurrently by another request
+		}
+
+		liked = true
+		return tx.Model(&answer).UpdateColumn("like_count", gorm.Expr("like_count + 1")).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update like"})
+	}
+
+	var likeCount int
+	h.DB.Model(&models.Answer{}).Where("id = ?", answer.ID).Pluck("like_count", &likeCount)
+
+	// Notify the answerer about new likes from other users
+	if liked {
+		var tell models.Tell
+		if result := h.DB.First(&tell, "id = ?", answer.TellID); result.Error == nil && tell.ReceiverID != userUUID {
+			var liker models.User
+			h.DB.Select("id, username, full_name, avatar").First(&liker, "id = ?", userUUID)
+
+			h.Notify.Send(notify.Event{
+				UserID:  tell.ReceiverID,
+				ActorID: &userUUID,
+				Payload: notify.LikePayload{TellID: tell.ID, AnswerID: answer.ID, LikeID: like.ID},
+				Realtime: fiber.Map{
+					"tell_id":    tell.ID,
+					"answer_id":  answer.ID,
+					"like_count": likeCount,
+					"user": fiber.Map{
+						"id":        liker.ID,
+						"username":  liker.Username,
+						"full_name": liker.FullName,
+						"avatar":    liker.Avatar,
+					},
+				},
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{"liked": liked, "like_count": likeCount})
+}
+
+// GetAnswerLikes lists the users who liked an answer, most recent first
+func (h *TellHandler) GetAnswerLikes(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+
+	var limit, offset int
+	if _, err := fmt.Sscanf(c.Query("limit", "50"), "%d", &limit); err != nil || limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if _, err := fmt.Sscanf(c.Query("offset", "0"), "%d", &offset); err != nil || offset < 0 {
+		offset = 0
+	}
+
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("answers.id = ?", answerID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found"})
+	}
+
+	var likes []models.Like
+	if result := h.DB.Where("answer_id = ?", answer.ID).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username, full_name, avatar")
+		}).
+		Order("created_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&likes); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch likes"})
+	}
+
+	users := make([]fiber.Map, 0, len(likes))
+	for _, like := range likes {
+		if like.User == nil {
+			continue
+		}
+		users = append(users, fiber.Map{
+			"id":        like.User.ID,
+			"username":  like.User.Username,
+			"full_name": like.User.FullName,
+			"avatar":    like.User.Avatar,
+			"liked_at":  like.CreatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"users":      users,
+		"like_count": answer.LikeCount,
+	})
+}
+
+// MaxPinnedAnswers is how many answers a user can pin to the top of their profile
+const MaxPinnedAnswers = 3
+
+// pinnedAnswerIDs returns the user's pinned answers in pin order. It locks the
+// user's row until the transaction ends, so concurrent pin changes run one
+// after another and can't both pass the cap or share a position.
+func pinnedAnswerIDs(tx *gorm.DB, userID string) ([]uuid.UUID, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&models.User{}, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	err := tx.Model(&models.Answer{}).
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("tells.receiver_id = ? AND answers.pin_position IS NOT NULL", userID).
+		Order("answers.pin_position asc").
+		Pluck("answers.id", &ids).Error
+	return ids, err
+}
+
+// setPinOrder stores ids as the user's pins, in order
+func setPinOrder(tx *gorm.DB, ids []uuid.UUID) error {
+	for i, id := range ids {
+		if err := tx.Model(&models.Answer{}).Where("id = ?", id).Update("pin_position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PinAnswer pins one of the receiver's answers to the bottom of their pinned list
+func (h *TellHandler) PinAnswer(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+
+	// Only the receiver of the tell can pin its answer
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id AND tells.deleted_at IS NULL").
+		Where("answers.id = ? AND tells.receiver_id = ?", answerID, userID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found or unauthorized"})
+	}
+
+	if answer.PinPosition != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Answer is already pinned"})
+	}
+
+	var pinned []uuid.UUID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		ids, err := pinnedAnswerIDs(tx, userID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id == answer.ID {
+				return fiber.NewError(fiber.StatusBadRequest, "Answer is already pinned")
+			}
+		}
+		if len(ids) >= MaxPinnedAnswers {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("You can pin up to %d answers", MaxPinnedAnswers))
+		}
+
+		pinned = append(ids, answer.ID)
+		return setPinOrder(tx, pinned)
+	})
+	if err != nil {
+		if e, ok := err.(*fiber.Error); ok {
+			return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not pin answer"})
+	}
+
+	return c.JSON(fiber.Map{"pinned": pinned})
+}
+
+// UnpinAnswer removes an answer from the receiver's pinned list
+func (h *TellHandler) UnpinAnswer(c *fiber.Ctx) error {
+	answerID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+
+	var answer models.Answer
+	if result := h.DB.
+		Joins("INNER JOIN tells ON tells.id = answers.tell_id").
+		Where("answers.id = ? AND tells.receiver_id = ?", answerID, userID).
+		First(&answer); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Answer not found or unauthorized"})
+	}
+
+	if answer.PinPosition == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Answer is not pinned"})
+	}
+
+	var pinned []uuid.UUID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Take the lock before changing anything
+		if _, err := pinnedAnswerIDs(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Model(&answer).Update("pin_position", nil).Error; err != nil {
+			return err
+		}
+
+		// Close the gap left by the removed pin
+		ids, err := pinnedAnswerIDs(tx, userID)
+		if err != nil {
+			return err
+		}
+		pinned = ids
+		return setPinOrder(tx, pinned)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not unpin answer"})
+	}
+
+	return c.JSON(fiber.Map{"pinned": pinned})
+}
+
+// ReorderPins sets the order of the receiver's pinned answers
+func (h *TellHandler) ReorderPins(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	type ReorderInput struct {
+		AnswerIDs []uuid.UUID `json:"answer_ids"`
+	}
+
+	var input ReorderInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		ids, err := pinnedAnswerIDs(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// The new order must contain exactly the currently pinned answers
+		current := make(map[uuid.UUID]bool, len(ids))
+		for _, id := range ids {
+			current[id] = true
+		}
+		if len(input.AnswerIDs) != len(ids) {
+			return fiber.NewError(fiber.StatusBadRequest, "Order must include every pinned answer exactly once")
+		}
+		for _, id := range input.AnswerIDs {
+			if !current[id] {
+				return fiber.NewError(fiber.StatusBadRequest, "Order must include every pinned answer exactly once")
+			}
+			delete(current, id)
+		}
+
+		return setPinOrder(tx, input.AnswerIDs)
+	})
+	if err != nil {
+		if e, ok := err.(*fiber.Error); ok {
+			return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reorder pins"})
+	}
+
+	return c.JSON(fiber.Map{"pinned": input.AnswerIDs})
+}
+
+// markLikedByMe flags the answers in tells that the viewer has liked
+func (h *TellHandler) markLikedByMe(viewerID string, tells []models.Tell) {
+	if viewerID == "" {
+		return
+	}
+
+	var answerIDs []uuid.UUID
+	for _, tell := range tells {
+		if tell.Answer != nil {
+			answerIDs = append(answerIDs, tell.Answer.ID)
+		}
+	}
+	if len(answerIDs) == 0 {
+		return
+	}
+
+	var likedIDs []uuid.UUID
+	h.DB.Model(&models.Like{}).
+		Where("user_id = ? AND answer_id IN ?", viewerID, answerIDs).
+		Pluck("answer_id", &likedIDs)
+
+	liked := make(map[uuid.UUID]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+
+	for i := range tells {
+		if tells[i].Answer != nil {
+			tells[i].Answer.LikedByMe = liked[tells[i].Answer.ID]
+		}
+	}
+}
+
 func (h *TellHandler) GetUnansweredCount(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	var count int64
@@ -194,6 +698,7 @@ func (h *TellHandler) GetUnansweredCount(c *fiber.Ctx) error {
 	// Count tells where receiver is user AND no answer exists
 	if result := h.DB.Model(&models.Tell{}).
 		Where("receiver_id = ?", userID).
+		Where("archived_at IS NULL").
 		Where("id NOT IN (SELECT tell_id FROM answers)").
 		Count(&count); result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch count"})
@@ -205,17 +710,28 @@ func (h *TellHandler) GetUnansweredCount(c *fiber.Ctx) error {
 func (h *TellHandler) GetSentTells(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
+	page, err := parseTellPage(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	query, err := applyTellFilters(c, h.DB.Where("sender_id = ?", userID))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	var tells []models.Tell
-	if result := h.DB.Where("sender_id = ?", userID).
+	if result := page.apply(query).
 		Preload("Receiver").
-		Preload("Answer").
-		Preload("Answer.Replies").
-		Order("created_at desc").
+		Preload("Answer.Mentions").
+		Preload("Answer.Replies.Mentions").
 		Find(&tells); result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch sent tells"})
 	}
 
-	return c.JSON(tells)
+	tells, nextCursor := page.trim(tells)
+
+	return c.JSON(pageResponse(tells, nextCursor))
 }
 
 func (h *TellHandler) ReplyToAnswer(c *fiber.Ctx) error {
@@ -252,16 +768,47 @@ func (h *TellHandler) ReplyToAnswer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
+	// The thread is between sender and receiver; a block between them closes it
+	if tell.SenderID != nil {
+		blocked, err := isBlockedBetween(h.DB, *tell.SenderID, tell.ReceiverID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check blocks"})
+		}
+		if blocked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can't reply to this user"})
+		}
+	}
+
 	reply := models.Reply{
 		AnswerID: answer.ID,
 		SenderID: senderUUID,
 		Content:  input.Content,
 	}
 
-	if result := h.DB.Create(&reply); result.Error != nil {
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&reply).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Answer{}).Where("id = ?", answer.ID).UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error; err != nil {
+			return err
+		}
+		if err := refreshSearchVector(tx, answer.ID); err != nil {
+			return err
+		}
+
+		mentions, err := resolveMentions(tx, senderUUID, reply.Content)
+		if err != nil {
+			return err
+		}
+		reply.Mentions = mentions
+		return saveMentions(tx, reply.Mentions, nil, &reply.ID)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create reply"})
 	}
 
+	// An anonymous sender stays anonymous to the people they mention
+	notifyMentions(h.Notify, reply.Mentions, senderUUID, tell.IsAnonymous && isOriginalSender, tell.ID)
+
 	// Notify the other party
 	var notifyUserID uuid.UUID
 	if isOriginalSender {
@@ -271,19 +818,21 @@ func (h *TellHandler) ReplyToAnswer(c *fiber.Ctx) error {
 	}
 
 	if notifyUserID != uuid.Nil {
-		ws.GlobalManager.SendMessage(notifyUserID.String(), fiber.Map{
-			"type":    "new_reply",
-			"tell_id": tell.ID,
-			"reply":   reply,
-		})
+		// An anonymous sender's replies stay anonymous
+		var actorID *uuid.UUID
+		shown := reply
+		if tell.IsAnonymous && isOriginalSender {
+			shown.SenderID = uuid.Nil
+		} else {
+			actorID = &senderUUID
+		}
 
-		// Send Email
-		go func() {
-			var notifyUser models.User
-			if result := h.DB.Select("email").First(&notifyUser, "id = ?", notifyUserID); result.Error == nil && notifyUser.Email != "" {
-				utils.SendNewReplyEmail(notifyUser.Email)
-			}
-		}()
+		h.Notify.Send(notify.Event{
+			UserID:   notifyUserID,
+			ActorID:  actorID,
+			Payload:  notify.NewReplyPayload{TellID: tell.ID, ReplyID: reply.ID, Preview: notify.Preview(reply.Content)},
+			Realtime: fiber.Map{"tell_id": tell.ID, "reply": shown},
+		})
 	}
 
 	return c.JSON(reply)
@@ -298,17 +847,41 @@ func (h *TellHandler) GetUserTells(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	page, err := parseTellPage(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Get tells with answers only
-	var tells []models.Tell
-	if result := h.DB.Where("receiver_id = ?", user.ID).
+	base, err := applyTellFilters(c, h.DB.Where("receiver_id = ?", user.ID).
 		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
-		Preload("Answer").
-		Preload("Answer.Replies").
-		Order("created_at desc").
+		Preload("Answer.Mentions").
+		Preload("Answer.Replies.Mentions"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Pinned answers lead the first page; later pages only walk the unpinned ones
+	var pinned []models.Tell
+	if page.After == nil {
+		if result := base.Session(&gorm.Session{}).
+			Where("answers.pin_position IS NOT NULL").
+			Order("answers.pin_position asc").
+			Find(&pinned); result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tells"})
+		}
+	}
+
+	var tells []models.Tell
+	if result := page.apply(base.Session(&gorm.Session{}).Where("answers.pin_position IS NULL")).
 		Find(&tells); result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tells"})
 	}
 
+	tells, nextCursor := page.trim(tells)
+	tells = append(pinned, tells...)
+	h.markLikedByMe(viewerID(c), tells)
+
 	// Build response with receiver info
 	type TellWithReceiver struct {
 		models.Tell
@@ -320,7 +893,7 @@ func (h *TellHandler) GetUserTells(c *fiber.Ctx) error {
 		} `json:"receiver"`
 	}
 
-	var result []TellWithReceiver
+	result := make([]TellWithReceiver, 0, len(tells))
 	for _, tell := range tells {
 		item := TellWithReceiver{Tell: tell}
 		item.Receiver.ID = user.ID
@@ -343,173 +916,435 @@ func (h *TellHandler) GetUserTells(c *fiber.Ctx) error {
 		result = append(result, item)
 	}
 
-	return c.JSON(result)
+	return c.JSON(pageResponse(result, nextCursor))
 }
 
-// GetPublicFeed returns all answered tells, prioritizing followed users then others, sorted by newest answered
+// GetPublicFeed returns answered tells, followed users first and then everyone else,
+// each group sorted by newest answer. Pages are keyset-paginated on
+// (priority, answered_at, id) so the cost stays flat as the table grows.
 func (h *TellHandler) GetPublicFeed(c *fiber.Ctx) error {
-	limitStr := c.Query("limit", "20")
-	offsetStr := c.Query("offset", "0")
-	userIDStr := c.Query("user_id", "") // Current logged-in user ID (optional)
+	userIDStr := viewerID(c) // Logged-in viewer, if any
+	limit := parseLimit(c)
+
+	switch c.Query("mode", "latest") {
+	case "latest":
+	case "for_you":
+		// Anonymous visitors have no graph to rank against; they get the latest feed
+		if userIDStr != "" {
+			h.markFeedViewed(userIDStr)
+			if handled, err := h.getRankedFeed(c, userIDStr, limit); handled {
+				return err
+			}
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid mode"})
+	}
 
-	var limit, offset int
-	if _, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || limit <= 0 {
-		limit = 20
+	var after *feedCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		var err error
+		if after, err = decodeFeedCursor(cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
 	}
-	if _, err := fmt.Sscanf(offsetStr, "%d", &offset); err != nil || offset < 0 {
-		offset = 0
+
+	rows, err := h.feedRows(userIDStr, after, limit+1)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch feed"})
 	}
 
-	type FeedItem struct {
-		models.Tell
-		Receiver struct {
-			ID       uuid.UUID `json:"id"`
-			Username string    `json:"username"`
-			FullName string    `json:"full_name"`
-			Avatar   string    `json:"avatar"`
-		} `json:"receiver"`
-		IsFromFollowing bool `json:"is_from_following"`
-	}
-
-	var feedItems []FeedItem
-
-	// If user is logged in, get their following list and prioritize those tells
-	if userIDStr != "" {
-		// Get list of user IDs that the current user is following
-		var followingIDs []uuid.UUID
-		h.DB.Model(&models.Follow{}).
-			Where("follower_id = ?", userIDStr).
-			Pluck("following_id", &followingIDs)
-
-		if len(followingIDs) > 0 {
-			// First: Get tells from followed users (sorted by newest answered)
-			var followedTells []models.Tell
-			h.DB.
-				Where("receiver_id IN ?", followingIDs).
-				Joins("INNER JOIN answers ON answers.tell_id = tells.id").
-				Preload("Answer").
-				Preload("Answer.Replies").
-				Order("answers.created_at desc").
-				Find(&followedTells)
-
-			// Add followed tells to feed
-			for _, tell := range followedTells {
-				var receiver models.User
-				h.DB.Select("id, username, full_name, avatar").First(&receiver, "id = ?", tell.ReceiverID)
-
-				item := FeedItem{Tell: tell, IsFromFollowing: true}
-				item.Receiver.ID = receiver.ID
-				item.Receiver.Username = receiver.Username
-				item.Receiver.FullName = receiver.FullName
-				item.Receiver.Avatar = receiver.Avatar
-
-				// Hide SenderID if anonymous
-				if tell.IsAnonymous {
-					item.Tell.SenderID = nil
-					if item.Tell.Answer != nil {
-						for j := range item.Tell.Answer.Replies {
-							if item.Tell.Answer.Replies[j].SenderID != tell.ReceiverID {
-								item.Tell.Answer.Replies[j].SenderID = uuid.Nil
-							}
-						}
-					}
-				}
+	var nextCursor *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		next := encodeFeedCursor(last.Priority, last.AnsweredAt, last.ID)
+		nextCursor = &next
+	}
 
-				feedItems = append(feedItems, item)
-			}
+	feedItems, err := h.buildFeedItems(userIDStr, rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch feed"})
+	}
 
-			// Second: Get tells from non-followed users (sorted by newest answered)
-			var otherTells []models.Tell
-			h.DB.
-				Where("receiver_id NOT IN ?", followingIDs).
-				Where("receiver_id != ?", userIDStr). // Exclude own tells
-				Joins("INNER JOIN answers ON answers.tell_id = tells.id").
-				Preload("Answer").
-				Preload("Answer.Replies").
-				Order("answers.created_at desc").
-				Find(&otherTells)
-
-			// Add other tells to feed
-			for _, tell := range otherTells {
-				var receiver models.User
-				h.DB.Select("id, username, full_name, avatar").First(&receiver, "id = ?", tell.ReceiverID)
-
-				item := FeedItem{Tell: tell, IsFromFollowing: false}
-				item.Receiver.ID = receiver.ID
-				item.Receiver.Username = receiver.Username
-				item.Receiver.FullName = receiver.FullName
-				item.Receiver.Avatar = receiver.Avatar
-
-				// Hide SenderID if anonymous
-				if tell.IsAnonymous {
-					item.Tell.SenderID = nil
-					if item.Tell.Answer != nil {
-						for j := range item.Tell.Answer.Replies {
-							if item.Tell.Answer.Replies[j].SenderID != tell.ReceiverID {
-								item.Tell.Answer.Replies[j].SenderID = uuid.Nil
-							}
-						}
-					}
-				}
+	return c.JSON(pageResponse(feedItems, nextCursor))
+}
+
+// FeedItem is an answered tell as shown in the public feed
+type FeedItem struct {
+	models.Tell
+	Receiver struct {
+		ID       uuid.UUID `json:"id"`
+		Username string    `json:"username"`
+		FullName string    `json:"full_name"`
+		Avatar   string    `json:"avatar"`
+	} `json:"receiver"`
+	IsFromFollowing bool `json:"is_from_following"`
+}
+
+// buildFeedItems loads answers for the rows and shapes them for the viewer
+func (h *TellHandler) buildFeedItems(viewerID string, rows []feedRow) ([]FeedItem, error) {
+	tells := make([]models.Tell, len(rows))
+	for i, row := range rows {
+		tells[i] = row.Tell
+	}
+	if err := h.loadAnswers(tells); err != nil {
+		return nil, err
+	}
+	h.markLikedByMe(viewerID, tells)
+
+	feedItems := make([]FeedItem, len(rows))
+	for i, row := range rows {
+		item := FeedItem{Tell: tells[i], IsFromFollowing: row.Priority == 0}
+		item.Receiver.ID = row.ReceiverID
+		item.Receiver.Username = row.ReceiverUsername
+		item.Receiver.FullName = row.ReceiverFullName
+		item.Receiver.Avatar = row.ReceiverAvatar
+
+		hideAnonymousSender(&item.Tell)
+		feedItems[i] = item
+	}
+
+	return feedItems, nil
+}
+
+// feedRow is one answered tell as returned by the feed query, with receiver fields joined in
+type feedRow struct {
+	models.Tell
+	Priority         int       // 0 = from a followed user, 1 = everyone else
+	AnsweredAt       time.Time // answers.created_at
+	ReceiverUsername string
+	ReceiverFullName string
+	ReceiverAvatar   string
+	Rank             int // Position in the ranked feed; unused by the latest feed
+}
+
+// feedRowColumns selects the feedRow extras; the query must join answers and users (the receiver)
+const feedRowColumns = `answers.created_at AS answered_at,
+	users.username AS receiver_username, users.full_name AS receiver_full_name, users.avatar AS receiver_avatar`
+
+// feedRows runs the feed as one UNION ALL query: each priority bucket is
+// index-ordered and limited on its own, then merged. Only limit rows per
+// bucket are ever read, regardless of how many answers exist.
+func (h *TellHandler) feedRows(viewerID string, after *feedCursor, limit int) ([]feedRow, error) {
+	bucket := func(priority int) *gorm.DB {
+		q := h.DB.Model(&models.Tell{}).
+			Select(fmt.Sprintf("tells.*, %d AS priority, %s", priority, feedRowColumns)).
+			Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+			Joins("INNER JOIN users ON users.id = tells.receiver_id")
+
+		if after != nil && after.Priority == priority {
+			q = q.Where("(answers.created_at, tells.id) < (?, ?)", after.AnsweredAt, after.ID)
+		}
+
+		return q.Order("answers.created_at desc").Order("tells.id desc").Limit(limit)
+	}
+
+	var rows []feedRow
+	if viewerID == "" {
+		err := bucket(1).Scan(&rows).Error
+		return rows, err
+	}
+
+	following := h.DB.Model(&models.Follow{}).Select("following_id").Where("follower_id = ?", viewerID)
+	blocked := blockedWith(h.DB, viewerID)
+
+	others := bucket(1).
+		Where("tells.receiver_id NOT IN (?)", following).
+		Where("tells.receiver_id NOT IN (?)", blocked).
+		Where("tells.receiver_id != ?", viewerID) // Exclude own tells
+
+	// Once the cursor has moved past the followed bucket there is nothing left to read from it
+	if after != nil && after.Priority > 0 {
+		err := others.Scan(&rows).Error
+		return rows, err
+	}
+
+	followed := bucket(0).
+		Where("tells.receiver_id IN (?)", following).
+		Where("tells.receiver_id NOT IN (?)", blocked)
+
+	err := h.DB.Raw("(?) UNION ALL (?) ORDER BY priority asc, answered_at desc, id desc LIMIT ?", followed, others, limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// loadAnswers attaches answers and their replies to tells with two batched queries
+func (h *TellHandler) loadAnswers(tells []models.Tell) error {
+	if len(tells) == 0 {
+		return nil
+	}
+
+	tellIDs := make([]uuid.UUID, len(tells))
+	for i, tell := range tells {
+		tellIDs[i] = tell.ID
+	}
+
+	var answers []models.Answer
+	if err := h.DB.Where("tell_id IN ?", tellIDs).Preload("Mentions").Preload("Replies.Mentions").Find(&answers).Error; err != nil {
+		return err
+	}
+
+	byTell := make(map[uuid.UUID]*models.Answer, len(answers))
+	for i := range answers {
+		byTell[answers[i].TellID] = &answers[i]
+	}
+	for i := range tells {
+		tells[i].Answer = byTell[tells[i].ID]
+	}
+
+	return nil
+}
 
-				feedItems = append(feedItems, item)
+// hideAnonymousSender strips the sender of an anonymous tell, including from their replies
+func hideAnonymousSender(tell *models.Tell) {
+	if !tell.IsAnonymous {
+		return
+	}
+
+	tell.SenderID = nil
+	if tell.Answer != nil {
+		for j := range tell.Answer.Replies {
+			if tell.Answer.Replies[j].SenderID != tell.ReceiverID {
+				tell.Answer.Replies[j].SenderID = uuid.Nil
 			}
+		}
+	}
+}
+
+// TellRestoreWindow is how long a deleted tell stays in the trash before it is purged for good
+const TellRestoreWindow = 30 * 24 * time.Hour
+
+// maxBulkTells caps how many tells a single bulk request may touch
+const maxBulkTells = 100
 
-			// Apply pagination after combining
-			if offset >= len(feedItems) {
-				return c.JSON([]FeedItem{})
+// deleteAnswers hard-deletes answers together with everything hanging off them
+func deleteAnswers(tx *gorm.DB, answerIDs []uuid.UUID) error {
+	if len(answerIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("answer_id IN ? OR reply_id IN (?)", answerIDs,
+		tx.Model(&models.Reply{}).Select("id").Where("answer_id IN ?", answerIDs)).Delete(&models.Mention{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("answer_id IN ?", answerIDs).Delete(&models.Reply{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("answer_id IN ?", answerIDs).Delete(&models.AnswerRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("answer_id IN ?", answerIDs).Delete(&models.Like{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("answer_id IN ?", answerIDs).Delete(&models.AnswerTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", answerIDs).Delete(&models.Answer{}).Error
+}
+
+// applyTellAction runs a delete/restore/archive/unarchive action on tells owned by userID
+func (h *TellHandler) applyTellAction(userID, action string, tellIDs []uuid.UUID) (int64, error) {
+	now := time.Now()
+	query := h.DB.Model(&models.Tell{}).Where("id IN ? AND receiver_id = ?", tellIDs, userID)
+
+	var result *gorm.DB
+	switch action {
+	case "delete":
+		// Deleted answers give up their pin slot, in the same transaction so
+		// a failed delete doesn't leave the tell unpinned
+		var deleted int64
+		var answerIDs []uuid.UUID
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			owned := tx.Model(&models.Tell{}).Select("id").Where("id IN ? AND receiver_id = ?", tellIDs, userID)
+			if err := tx.Model(&models.Answer{}).Where("tell_id IN (?)", owned).Pluck("id", &answerIDs).Error; err != nil {
+				return err
 			}
-			end := offset + limit
-			if end > len(feedItems) {
-				end = len(feedItems)
+			if err := tx.Model(&models.Answer{}).Where("tell_id IN (?)", owned).Update("pin_position", nil).Error; err != nil {
+				return err
 			}
-			return c.JSON(feedItems[offset:end])
+			result := tx.Where("id IN ? AND receiver_id = ?", tellIDs, userID).Delete(&models.Tell{})
+			deleted = result.RowsAffected
+			return result.Error
+		})
+		if err == nil {
+			// Cached cards would otherwise stay reachable until the purge
+			removeAnswerCards(answerIDs...)
 		}
+		return deleted, err
+	case "restore":
+		result = h.DB.Unscoped().Model(&models.Tell{}).
+			Where("id IN ? AND receiver_id = ?", tellIDs, userID).
+			Where("deleted_at IS NOT NULL AND deleted_at > ?", now.Add(-TellRestoreWindow)).
+			Update("deleted_at", nil)
+	case "archive":
+		result = query.Where("archived_at IS NULL").Update("archived_at", now)
+	case "unarchive":
+		result = query.Where("archived_at IS NOT NULL").Update("archived_at", nil)
+	default:
+		return 0, fmt.Errorf("unknown action %q", action)
+	}
+
+	return result.RowsAffected, result.Error
+}
+
+// DeleteTell moves a received tell to the trash
+func (h *TellHandler) DeleteTell(c *fiber.Ctx) error {
+	return h.tellAction(c, "delete", "Tell deleted")
+}
+
+// RestoreTell brings a deleted tell back while it is still inside the restore window
+func (h *TellHandler) RestoreTell(c *fiber.Ctx) error {
+	return h.tellAction(c, "restore", "Tell restored")
+}
+
+// ArchiveTell hides a received tell from the inbox
+func (h *TellHandler) ArchiveTell(c *fiber.Ctx) error {
+	return h.tellAction(c, "archive", "Tell archived")
+}
+
+// UnarchiveTell moves an archived tell back to the inbox
+func (h *TellHandler) UnarchiveTell(c *fiber.Ctx) error {
+	return h.tellAction(c, "unarchive", "Tell unarchived")
+}
+
+func (h *TellHandler) tellAction(c *fiber.Ctx, action, message string) error {
+	userID := c.Locals("user_id").(string)
+
+	tellID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tell ID"})
+	}
+
+	affected, err := h.applyTellAction(userID, action, []uuid.UUID{tellID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update tell"})
+	}
+	if affected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tell not found or unauthorized"})
+	}
+
+	return c.JSON(fiber.Map{"message": message})
+}
+
+// BulkTellAction applies the same action to several received tells at once
+func (h *TellHandler) BulkTellAction(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	type BulkInput struct {
+		IDs    []uuid.UUID `json:"ids"`
+		Action string      `json:"action"` // delete, restore, archive or unarchive
+	}
+
+	var input BulkInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if len(input.IDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No tells selected"})
+	}
+	if len(input.IDs) > maxBulkTells {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cannot update more than %d tells at once", maxBulkTells),
+		})
+	}
+
+	switch input.Action {
+	case "delete", "restore", "archive", "unarchive":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid action"})
 	}
 
-	// Fallback: No user logged in or user has no followings - just get all tells sorted by newest
+	affected, err := h.applyTellAction(userID, input.Action, input.IDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update tells"})
+	}
+
+	return c.JSON(fiber.Map{"updated": affected})
+}
+
+// GetDeletedTells lists tells in the trash that can still be restored
+func (h *TellHandler) GetDeletedTells(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
 	var tells []models.Tell
-	query := h.DB.
-		Joins("INNER JOIN answers ON answers.tell_id = tells.id").
+	if result := h.DB.Unscoped().
+		Where("receiver_id = ?", userID).
+		Where("deleted_at IS NOT NULL AND deleted_at > ?", time.Now().Add(-TellRestoreWindow)).
 		Preload("Answer").
-		Preload("Answer.Replies").
-		Order("answers.created_at desc").
-		Limit(limit).
-		Offset(offset)
+		Order("deleted_at desc").
+		Find(&tells); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch deleted tells"})
+	}
 
-	// Exclude own tells if user is logged in
-	if userIDStr != "" {
-		query = query.Where("receiver_id != ?", userIDStr)
+	// Hide SenderID if anonymous
+	for i := range tells {
+		if tells[i].IsAnonymous {
+			tells[i].SenderID = nil
+		}
 	}
 
-	if result := query.Find(&tells); result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch feed"})
+	return c.JSON(fiber.Map{
+		"tells":               tells,
+		"restore_window_days": int(TellRestoreWindow.Hours() / 24),
+	})
+}
+
+// DeleteAnswer removes the receiver's answer (and its replies), returning the tell to unanswered
+func (h *TellHandler) DeleteAnswer(c *fiber.Ctx) error {
+	tellID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+
+	var tell models.Tell
+	if result := h.DB.Where("id = ? AND receiver_id = ?", tellID, userID).Preload("Answer").First(&tell); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tell not found or unauthorized"})
 	}
 
-	for _, tell := range tells {
-		var receiver models.User
-		h.DB.Select("id, username, full_name, avatar").First(&receiver, "id = ?", tell.ReceiverID)
+	if tell.Answer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tell has no answer"})
+	}
 
-		item := FeedItem{Tell: tell, IsFromFollowing: false}
-		item.Receiver.ID = receiver.ID
-		item.Receiver.Username = receiver.Username
-		item.Receiver.FullName = receiver.FullName
-		item.Receiver.Avatar = receiver.Avatar
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteAnswers(tx, []uuid.UUID{tell.Answer.ID})
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete answer"})
+	}
 
-		// Hide SenderID if anonymous
-		if tell.IsAnonymous {
-			item.Tell.SenderID = nil
-			if item.Tell.Answer != nil {
-				for j := range item.Tell.Answer.Replies {
-					if item.Tell.Answer.Replies[j].SenderID != tell.ReceiverID {
-						item.Tell.Answer.Replies[j].SenderID = uuid.Nil
-					}
-				}
-			}
-		}
+	removeAnswerCards(tell.Answer.ID)
+
+	return c.JSON(fiber.Map{"message": "Answer deleted"})
+}
+
+// PurgeDeletedTells permanently removes tells whose restore window has passed
+func (h *TellHandler) PurgeDeletedTells() error {
+	cutoff := time.Now().Add(-TellRestoreWindow)
+
+	var tellIDs []uuid.UUID
+	if err := h.DB.Unscoped().Model(&models.Tell{}).
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).
+		Pluck("id", &tellIDs).Error; err != nil {
+		return err
+	}
 
-		feedItems = append(feedItems, item)
+	if len(tellIDs) == 0 {
+		return nil
 	}
 
-	return c.JSON(feedItems)
+	var answerIDs []uuid.UUID
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Answer{}).Where("tell_id IN ?", tellIDs).Pluck("id", &answerIDs).Error; err != nil {
+			return err
+		}
+		if err := deleteAnswers(tx, answerIDs); err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", tellIDs).Delete(&models.Tell{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	removeAnswerCards(answerIDs...)
+
+	log.Printf("🗑️ Purged %d deleted tells", len(tellIDs))
+	return nil
 }
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"prswjo/models"
+	"prswjo/testdb"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// seedFeed spreads the given number of answered tells over 200 users and
+// adds a viewer who follows 20 of them
+func seedFeed(b *testing.B, db *gorm.DB, answers int) uuid.UUID {
+	b.Helper()
+
+	steps := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`INSERT INTO users (username, full_name, email, created_at, updated_at)
+			SELECT 'user' || i, 'User ' || i, 'user' || i || '@example.com', now(), now()
+			FROM generate_series(0, 200) i`, nil},
+		{`INSERT INTO tells (receiver_id, content, is_anonymous, created_at)
+			SELECT (SELECT id FROM users WHERE username = 'user' || (1 + i % 200)), 'Tell ' || i, true, now() - i * interval '1 minute'
+			FROM generate_series(1, ?) i`, []interface{}{answers}},
+		{`INSERT INTO answers (tell_id, content, created_at)
+			SELECT id, 'Answer', created_at + interval '30 seconds' FROM tells`, nil},
+		{`INSERT INTO follows (follower_id, following_id, created_at)
+			SELECT (SELECT id FROM users WHERE username = 'user0'), id, now()
+			FROM users WHERE username IN (SELECT 'user' || i FROM generate_series(1, 20) i)`, nil},
+		{`ANALYZE`, nil},
+	}
+	for _, step := range steps {
+		if err := db.Exec(step.sql, step.args...).Error; err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+	}
+
+	var viewerID uuid.UUID
+	if err := db.Raw("SELECT id FROM users WHERE username = 'user0'").Scan(&viewerID).Error; err != nil {
+		b.Fatalf("seed: %v", err)
+	}
+	return viewerID
+}
+
+// BenchmarkFeedRows pages through the public feed at two table sizes; the
+// time per page should stay about the same as the answer count grows.
+func BenchmarkFeedRows(b *testing.B) {
+	for _, answers := range []int{1000, 50000} {
+		b.Run(fmt.Sprintf("answers=%d", answers), func(b *testing.B) {
+			h := &TellHandler{DB: testdb.Open(b)}
+			viewerID := seedFeed(b, h.DB, answers).String()
+
+			// A cursor deep in the "everyone else" bucket
+			first, err := h.feedRows(viewerID, nil, answers/2)
+			if err != nil {
+				b.Fatal(err)
+			}
+			last := first[len(first)-1]
+			deep := &feedCursor{Priority: last.Priority, AnsweredAt: last.AnsweredAt, ID: last.ID}
+
+			b.Run("first page", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := h.feedRows(viewerID, nil, defaultPageSize+1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("deep page", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := h.feedRows(viewerID, deep, defaultPageSize+1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("anonymous", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := h.feedRows("", nil, defaultPageSize+1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestPinAnswerConcurrently pins more answers than allowed all at once; the
+// cap must hold and every pin must get its own position
+func TestPinAnswerConcurrently(t *testing.T) {
+	h := &TellHandler{DB: testdb.Open(t)}
+
+	user := models.User{Username: "pinner", Email: "pinner@example.com"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	var answerIDs []uuid.UUID
+	for i := 0; i < MaxPinnedAnswers+3; i++ {
+		tell := models.Tell{ReceiverID: user.ID, Content: "Tell"}
+		if err := h.DB.Create(&tell).Error; err != nil {
+			t.Fatal(err)
+		}
+		answer := models.Answer{TellID: tell.ID, Content: "Answer"}
+		if err := h.DB.Create(&answer).Error; err != nil {
+			t.Fatal(err)
+		}
+		answerIDs = append(answerIDs, answer.ID)
+	}
+
+	app := fiber.New()
+	app.Post("/answers/:id/pin", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID.String())
+		return c.Next()
+	}, h.PinAnswer)
+
+	var wg sync.WaitGroup
+	for _, id := range answerIDs {
+		wg.Add(1)
+		go func(id uuid.UUID) {
+			defer wg.Done()
+			if _, err := app.Test(httptest.NewRequest("POST", "/answers/"+id.String()+"/pin", nil), -1); err != nil {
+				t.Error(err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	var positions []int
+	if err := h.DB.Model(&models.Answer{}).Where("pin_position IS NOT NULL").Order("pin_position").
+		Pluck("pin_position", &positions).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := make([]int, MaxPinnedAnswers)
+	for i := range want {
+		want[i] = i
+	}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("pin positions %v, want %v", positions, want)
+	}
+}
+
+// TestEditAnswerConcurrently edits one answer twice at once; the history
+// must hold every version, not the same old content twice
+func TestEditAnswerConcurrently(t *testing.T) {
+	h := &TellHandler{DB: testdb.Open(t)}
+
+	user := models.User{Username: "editor", Email: "editor@example.com"}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tell := models.Tell{ReceiverID: user.ID, Content: "Tell"}
+	if err := h.DB.Create(&tell).Error; err != nil {
+		t.Fatal(err)
+	}
+	answer := models.Answer{TellID: tell.ID, Content: "first"}
+	if err := h.DB.Create(&answer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Put("/answers/:id", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID.String())
+		return c.Next()
+	}, h.EditAnswer)
+
+	var wg sync.WaitGroup
+	for _, content := range []string{"second", "third"} {
+		wg.Add(1)
+		go func(content string) {
+			defer wg.Done()
+			req := httptest.NewRequest("PUT", "/answers/"+answer.ID.String(), strings.NewReader(`{"content":"`+content+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if _, err := app.Test(req, -1); err != nil {
+				t.Error(err)
+			}
+		}(content)
+	}
+	wg.Wait()
+
+	var revisions []string
+	if err := h.DB.Model(&models.AnswerRevision{}).Where("answer_id = ?", answer.ID).
+		Order("created_at").Pluck("content", &revisions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := h.DB.First(&answer, "id = ?", answer.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	versions := append(revisions, answer.Content)
+	sort.Strings(versions)
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("history %v then %q; want every version once", revisions, answer.Content)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+
+	"prswjo/models"
+	"prswjo/notify"
+	"prswjo/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// unsubscribeStrings are the localized texts of the unsubscribe page
+type unsubscribeStrings struct {
+	RTL      bool
+	Title    string
+	Confirm  string
+	Button   string
+	Done     string
+	Settings string
+	BadLink  string
+}
+
+var unsubscribeLanguages = map[string]unsubscribeStrings{
+	"en": {
+		Title:    "Unsubscribe",
+		Confirm:  "Stop getting these emails?",
+		Button:   "Unsubscribe",
+		Done:     "You won't get these emails anymore.",
+		Settings: "Change your notification settings",
+		BadLink:  "This unsubscribe link is invalid.",
+	},
+	"ar": {
+		RTL:      true,
+		Title:    "إلغاء الاشتراك",
+		Confirm:  "هل تريد التوقف عن تلقي هذه الرسائل؟",
+		Button:   "إلغاء الاشتراك",
+		Done:     "لن تصلك هذه الرسائل بعد الآن.",
+		Settings: "تغيير إعدادات الإشعارات",
+		BadLink:  "رابط إلغاء الاشتراك هذا غير صالح.",
+	},
+	"ku": {
+		RTL:      true,
+		Title:    "ڕاگرتنی ئیمەیل",
+		Confirm:  "دەتەوێت ئەم ئیمەیلانە ڕابگریت؟",
+		Button:   "ڕاگرتن",
+		Done:     "چیتر ئەم ئیمەیلانەت پێ ناگات.",
+		Settings: "گۆڕینی ڕێکخستنەکانی ئاگادارکردنەوە",
+		BadLink:  "ئەم بەستەرە دروست نییە.",
+	},
+}
+
+var unsubscribePageTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}"{{if .Strings.RTL}} dir="rtl"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Strings.Title}} - {{.SiteName}}</title>
+</head>
+<body style="font-family: 'Segoe UI', Roboto, Arial, sans-serif; background: #0a0a0f; color: #fff; text-align: center; padding: 60px 20px;">
+<h1>{{.Strings.Title}}</h1>
+{{- if .Invalid}}
+<p>{{.Strings.BadLink}}</p>
+{{- else if .Done}}
+<p>{{.Strings.Done}}</p>
+<p><a href="{{.SettingsURL}}" style="color: #a855f7;">{{.Strings.Settings}}</a></p>
+{{- else}}
+<p>{{.Strings.Confirm}}</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit" style="padding: 14px 40px; border: 0; border-radius: 14px; background: #8b5cf6; color: #fff; font-size: 16px; cursor: pointer;">{{.Strings.Button}}</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+// renderUnsubscribePage answers in the user's language when the token names one
+func (h *NotificationHandler) renderUnsubscribePage(c *fiber.Ctx, status int, userID uuid.UUID, token string, done bool) error {
+	lang := "en"
+	if userID != uuid.Nil {
+		var user models.User
+		if err := h.DB.Select("language").First(&user, "id = ?", userID).Error; err == nil {
+			lang = utils.Language(user.Language)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := unsubscribePageTemplate.Execute(&buf, fiber.Map{
+		"Lang":        lang,
+		"Strings":     unsubscribeLanguages[lang],
+		"SiteName":    utils.SiteName(),
+		"Token":       token,
+		"Invalid":     userID == uuid.Nil,
+		"Done":        done,
+		"SettingsURL": utils.FrontendURL() + "/profile",
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Could not render page")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set("Referrer-Policy", "no-referrer") // The token is in the URL
+	return c.Status(status).Send(buf.Bytes())
+}
+
+// UnsubscribePage is where the link in an email's footer goes. It only asks
+// for confirmation: link scanners fetch it, so it must not change anything.
+func (h *NotificationHandler) UnsubscribePage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	userID, _, err := notify.ParseUnsubscribeToken(token)
+	if err != nil {
+		return h.renderUnsubscribePage(c, fiber.StatusBadRequest, uuid.Nil, "", false)
+	}
+	return h.renderUnsubscribePage(c, fiber.StatusOK, userID, token, false)
+}
+
+// Unsubscribe turns off the email the token is for. Mail clients POST here
+// from the List-Unsubscribe header (RFC 8058) and get a bare response; the
+// confirmation form gets a page.
+func (h *NotificationHandler) Unsubscribe(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		token = c.FormValue("token")
+	}
+	oneClick := c.FormValue("List-Unsubscribe") == "One-Click"
+
+	userID, t, err := notify.ParseUnsubscribeToken(token)
+	if err != nil {
+		if oneClick {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid unsubscribe token"})
+		}
+		return h.renderUnsubscribePage(c, fiber.StatusBadRequest, uuid.Nil, "", false)
+	}
+
+	if err := h.Notify.Unsubscribe(userID, t); err != nil {
+		log.Printf("❌ Could not unsubscribe %s from %s email: %v", userID, t, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not unsubscribe"})
+	}
+	log.Printf("📧 %s unsubscribed from %s email", userID, t)
+
+	if oneClick {
+		return c.JSON(fiber.Map{"success": true})
+	}
+	return h.renderUnsubscribePage(c, fiber.StatusOK, userID, "", true)
+}
@@ -9,73 +9,186 @@ import (
 	"log"
 	"os"
 	"prswjo/models"
+	"prswjo/notify"
 	"prswjo/utils"
+	"strings"
 
 	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"golang.org/x/image/webp"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Notify *notify.Service
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{DB: db}
+func NewUserHandler(db *gorm.DB, notifier *notify.Service) *UserHandler {
+	return &UserHandler{DB: db, Notify: notifier}
 }
 
-func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
-	search := c.Query("search")
-	exclude := c.Query("exclude") // Exclude user by ID (current logged-in user)
-	limitStr := c.Query("limit")
-	offsetStr := c.Query("offset")
-	var users []models.User
+// Ranking knobs for the fuzzy user search
+const (
+	userSearchFollowBoost   = 0.3  // Users the viewer follows
+	userSearchFollowerBoost = 0.05 // Multiplied by ln(1 + follower count)
+)
 
-	query := h.DB.Model(&models.User{}).Where("is_verified = ?", true).Order("created_at desc")
+// searchUsersSQL finds users whose username or full name is similar to the
+// term (pg_trgm, backed by the GIN trigram indexes) or contains it. Exact
+// username matches come first, then prefix matches, then everything else by
+// similarity boosted for followed and popular users.
+const searchUsersSQL = `
+SELECT * FROM (
+	SELECT users.*,
+		CASE
+			WHEN LOWER(users.username) = LOWER(@term) THEN 0
+			WHEN users.username ILIKE @prefix OR users.full_name ILIKE @prefix THEN 1
+			ELSE 2
+		END AS match_rank,
+		GREATEST(similarity(users.username, @term), similarity(users.full_name, @term))
+			+ CASE WHEN EXISTS (
+				SELECT 1 FROM follows WHERE follows.follower_id = @viewer AND follows.following_id = users.id
+			) THEN @follow_boost ELSE 0 END
+			+ @follower_boost * LN(1 + (SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id)) AS score
+	FROM users
+	WHERE users.is_verified = true
+		AND users.id <> @viewer
+		AND (users.username % @term OR users.full_name % @term
+			OR users.username ILIKE @contains OR users.full_name ILIKE @contains)
+) ranked
+WHERE @first_page OR match_rank > @after_rank
+	OR (match_rank = @after_rank AND (score < @after_score OR (score = @after_score AND id > @after_id)))
+ORDER BY match_rank ASC, score DESC, id ASC
+LIMIT @limit`
+
+// userSearchRow is a user with the rank and score of a search match
+type userSearchRow struct {
+	models.User
+	MatchRank int
+	Score     float64
+}
+
+// GetUsers lists verified users, newest first, or searches them with ?search=.
+// Both are cursor-paginated; the logged-in user is left out.
+func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
+	search := strings.TrimSpace(c.Query("search"))
+	exclude := viewerID(c) // Exclude the current logged-in user
+	limit := parseLimit(c)
 
 	if search != "" {
-		query = query.Where("username ILIKE ? OR full_name ILIKE ?", "%"+search+"%", "%"+search+"%")
+		return h.searchUsers(c, search, exclude, limit)
 	}
 
+	query := h.DB.Model(&models.User{}).Where("is_verified = ?", true)
+
 	if exclude != "" {
 		query = query.Where("id != ?", exclude)
 	}
 
-	// Apply limit if provided
-	if limitStr != "" {
-		var limit int
-		fmt.Sscanf(limitStr, "%d", &limit)
-		if limit > 0 {
-			query = query.Limit(limit)
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
 		}
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var users []models.User
+	if result := query.Order("created_at desc").Order("id desc").Limit(limit + 1).Find(&users); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch users"})
 	}
 
-	// Apply offset if provided
-	if offsetStr != "" {
-		var offset int
-		fmt.Sscanf(offsetStr, "%d", &offset)
-		if offset > 0 {
-			query = query.Offset(offset)
+	var nextCursor *string
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[len(users)-1]
+		next := encodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &next
+	}
+
+	log.Printf("📋 GetUsers: Found %d verified users (exclude: '%s')", len(users), exclude)
+	return c.JSON(pageResponse(users, nextCursor))
+}
+
+// searchUsers runs the fuzzy user search
+func (h *UserHandler) searchUsers(c *fiber.Ctx, search, exclude string, limit int) error {
+	viewer := uuid.Nil
+	if exclude != "" {
+		viewer, _ = uuid.Parse(exclude)
+	}
+
+	after := &userSearchCursor{}
+	if cursor := c.Query("cursor"); cursor != "" {
+		var err error
+		if after, err = decodeUserSearchCursor(cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
 		}
 	}
 
-	if result := query.Find(&users); result.Error != nil {
+	escaped := escapeLike(search)
+
+	var rows []userSearchRow
+	if err := h.DB.Raw(searchUsersSQL, map[string]interface{}{
+		"term":           search,
+		"prefix":         escaped + "%",
+		"contains":       "%" + escaped + "%",
+		"viewer":         viewer,
+		"follow_boost":   userSearchFollowBoost,
+		"follower_boost": userSearchFollowerBoost,
+		"first_page":     c.Query("cursor") == "",
+		"after_rank":     after.MatchRank,
+		"after_score":    after.Score,
+		"after_id":       after.ID,
+		"limit":          limit + 1,
+	}).Scan(&rows).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch users"})
 	}
 
+	var nextCursor *string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		next := encodeUserSearchCursor(last.MatchRank, last.Score, last.ID)
+		nextCursor = &next
+	}
+
+	users := make([]models.User, len(rows))
+	for i, row := range rows {
+		users[i] = row.User
+	}
+
 	log.Printf("📋 GetUsers: Found %d verified users (search: '%s', exclude: '%s')", len(users), search, exclude)
-	return c.JSON(users)
+	return c.JSON(pageResponse(users, nextCursor))
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ownProfile is a user as they see themselves, with the account state
+// nobody else may see
+type ownProfile struct {
+	models.User
+	EmailNeedsUpdate bool `json:"email_needs_update"` // Change it with PUT /api/auth/email
+}
+
+func newOwnProfile(user models.User) ownProfile {
+	return ownProfile{User: user, EmailNeedsUpdate: user.EmailNeedsUpdate}
 }
 
 func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
 	type UpdateInput struct {
-		FullName string `json:"full_name"`
-		Bio      string `json:"bio"`
-		Avatar   string `json:"avatar"`
+		FullName      string `json:"full_name"`
+		Bio           string `json:"bio"`
+		Avatar        string `json:"avatar"`
+		MentionPolicy string `json:"mention_policy"`
+		Language      string `json:"language"`
 	}
 
 	var input UpdateInput
@@ -92,9 +205,24 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 	user.Bio = input.Bio
 	user.Avatar = input.Avatar
 
+	// Left unchanged when not sent
+	switch input.MentionPolicy {
+	case "":
+	case models.MentionEveryone, models.MentionFollowing, models.MentionNobody:
+		user.MentionPolicy = input.MentionPolicy
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid mention policy"})
+	}
+	if input.Language != "" {
+		if !utils.ValidLanguage(input.Language) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Language must be en, ar or ku"})
+		}
+		user.Language = input.Language
+	}
+
 	h.DB.Save(&user)
 
-	return c.JSON(user)
+	return c.JSON(newOwnProfile(user))
 }
 
 func (h *UserHandler) GetUserByUsername(c *fiber.Ctx) error {
@@ -255,6 +383,14 @@ func (h *UserHandler) FollowUser(c *fiber.Ctx) error {
 	followerUUID, _ := uuid.Parse(followerID)
 	followingUUID, _ := uuid.Parse(followingID)
 
+	blocked, err := isBlockedBetween(h.DB, followerUUID, followingUUID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check blocks"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can't follow this user"})
+	}
+
 	follow := models.Follow{
 		FollowerID:  followerUUID,
 		FollowingID: followingUUID,
@@ -265,39 +401,20 @@ func (h *UserHandler) FollowUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not follow user"})
 	}
 
-	// Send notification email to the followed user
-	go func() {
-		// Get the followed user's email
-		var followedUser models.User
-		if err := h.DB.First(&followedUser, "id = ?", followingID).Error; err != nil {
-			log.Printf("❌ Could not find followed user for notification: %v", err)
-			return
-		}
-
-		// Get follower's name (only if not anonymous)
-		var followerName string
-		if !input.IsAnonymous {
-			var follower models.User
-			if err := h.DB.First(&follower, "id = ?", followerID).Error; err == nil {
-				if follower.FullName != "" {
-					followerName = follower.FullName
-				} else {
-					followerName = follower.Username
-				}
-			}
-		}
+	if err := invalidateSuggestions(h.DB, followerUUID); err != nil {
+		log.Printf("❌ Could not invalidate suggestions: %v", err)
+	}
 
-		// Send the email
-		if err := utils.SendNewFollowerEmail(followedUser.Email, followerName, input.IsAnonymous); err != nil {
-			log.Printf("❌ Failed to send follower notification email: %v", err)
-		} else {
-			if input.IsAnonymous {
-				log.Printf("📧 Sent anonymous follower notification to %s", followedUser.Email)
-			} else {
-				log.Printf("📧 Sent follower notification to %s (from %s)", followedUser.Email, followerName)
-			}
-		}
-	}()
+	// Anonymous follows don't reveal the follower
+	var actorID *uuid.UUID
+	if !input.IsAnonymous {
+		actorID = &followerUUID
+	}
+	h.Notify.Send(notify.Event{
+		UserID:  followingUUID,
+		ActorID: actorID,
+		Payload: notify.FollowPayload{FollowID: follow.ID, Anonymous: input.IsAnonymous},
+	})
 
 	return c.JSON(fiber.Map{"message": "Followed successfully", "is_anonymous": input.IsAnonymous})
 }
@@ -312,6 +429,11 @@ func (h *UserHandler) UnfollowUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not following this user"})
 	}
 
+	followerUUID, _ := uuid.Parse(followerID)
+	if err := invalidateSuggestions(h.DB, followerUUID); err != nil {
+		log.Printf("❌ Could not invalidate suggestions: %v", err)
+	}
+
 	return c.JSON(fiber.Map{"message": "Unfollowed successfully"})
 }
 
@@ -406,3 +528,92 @@ func (h *UserHandler) GetFollowCounts(c *fiber.Ctx) error {
 		"following_count": followingCount,
 	})
 }
+
+// BlockUser blocks a user and removes any follow between the two accounts
+func (h *UserHandler) BlockUser(c *fiber.Ctx) error {
+	blockerID := c.Locals("user_id").(string)
+	blockedID := c.Params("id")
+
+	if blockerID == blockedID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot block yourself"})
+	}
+
+	blockerUUID, _ := uuid.Parse(blockerID)
+	blockedUUID, err := uuid.Parse(blockedID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var blocked models.User
+	if result := h.DB.First(&blocked, "id = ?", blockedUUID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		block := models.Block{BlockerID: blockerUUID, BlockedID: blockedUUID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			blockerUUID, blockedUUID, blockedUUID, blockerUUID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+
+		return invalidateSuggestions(tx, blockerUUID, blockedUUID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not block user"})
+	}
+
+	return c.JSON(fiber.Map{"message": "User blocked"})
+}
+
+// UnblockUser removes a block
+func (h *UserHandler) UnblockUser(c *fiber.Ctx) error {
+	blockerID := c.Locals("user_id").(string)
+	blockedID := c.Params("id")
+
+	result := h.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{})
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User is not blocked"})
+	}
+
+	blockerUUID, _ := uuid.Parse(blockerID)
+	if err := invalidateSuggestions(h.DB, blockerUUID); err != nil {
+		log.Printf("❌ Could not invalidate suggestions: %v", err)
+	}
+
+	return c.JSON(fiber.Map{"message": "User unblocked"})
+}
+
+// GetBlockedUsers lists the users the current user has blocked
+func (h *UserHandler) GetBlockedUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var users []models.User
+	if result := h.DB.
+		Joins("INNER JOIN blocks ON blocks.blocked_id = users.id").
+		Where("blocks.blocker_id = ?", userID).
+		Order("blocks.created_at desc").
+		Find(&users); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch blocked users"})
+	}
+
+	return c.JSON(users)
+}
+
+// isBlockedBetween reports whether either user has blocked the other. Callers
+// must refuse the action when it fails, never treat it as no block.
+func isBlockedBetween(db *gorm.DB, a, b uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// blockedWith is a subquery of everyone the user blocked or was blocked by
+func blockedWith(db *gorm.DB, userID string) *gorm.DB {
+	return db.Raw("SELECT blocked_id FROM blocks WHERE blocker_id = ? UNION SELECT blocker_id FROM blocks WHERE blocked_id = ?", userID, userID)
+}
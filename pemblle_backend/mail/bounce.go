@@ -0,0 +1,263 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+
+	"prswjo/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Bounce is an address that must not be mailed again
+type Bounce struct {
+	Address    string
+	Reason     string // models.SuppressHardBounce or models.SuppressComplaint
+	Status     string // DSN status code
+	Diagnostic string
+	MessageID  string // Of the returned original, which ties the report to mail we sent
+}
+
+// ParseReport reads a delivery status notification (RFC 3464) or a spam
+// complaint in the Abuse Reporting Format (RFC 5965). Permanent failures
+// (status 5.x.x) and complaints become bounces; delays, soft bounces and
+// anything that isn't a report give none. Anyone can send a report, so check
+// it with SuppressReport before acting on it.
+func ParseReport(r io.Reader) ([]Bounce, error) {
+	msg, err := netmail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, nil
+	}
+
+	var bounces []Bounce
+	var feedback textproto.MIMEHeader
+	var original netmail.Header
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := readPart(part)
+		if err != nil {
+			return nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			bounces = append(bounces, parseDeliveryStatus(body)...)
+		case "message/feedback-report":
+			feedback, _ = textproto.NewReader(bufio.NewReader(bytes.NewReader(append(body, "\r\n\r\n"...)))).ReadMIMEHeader()
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			if headers, err := netmail.ReadMessage(bytes.NewReader(append(body, "\r\n\r\n"...))); err == nil {
+				original = headers.Header
+			}
+		}
+	}
+
+	if params["report-type"] == "feedback-report" && feedback != nil {
+		// The complainer is whoever we sent the original to
+		address := feedback.Get("Original-Rcpt-To")
+		if address == "" && original != nil {
+			address = original.Get("To")
+		}
+		if address = normalizeAddress(address); address != "" {
+			bounces = append(bounces, Bounce{
+				Address:    address,
+				Reason:     models.SuppressComplaint,
+				Diagnostic: "Feedback-Type: " + feedback.Get("Feedback-Type"),
+			})
+		}
+	}
+
+	if original != nil {
+		for i := range bounces {
+			bounces[i].MessageID = original.Get("Message-ID")
+		}
+	}
+
+	return bounces, nil
+}
+
+// readPart returns a part's body, decoding base64 (multipart already
+// decodes quoted-printable)
+func readPart(part *multipart.Part) ([]byte, error) {
+	body, err := io.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(body)))
+	}
+	return body, nil
+}
+
+// parseDeliveryStatus reads the per-message and per-recipient field groups
+// of a delivery-status part, keeping recipients that failed for good
+func parseDeliveryStatus(body []byte) []Bounce {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(body, "\r\n\r\n"...))))
+
+	var bounces []Bounce
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if len(fields) > 0 {
+			action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+			status := strings.TrimSpace(fields.Get("Status"))
+			recipient := fields.Get("Final-Recipient")
+			if recipient == "" {
+				recipient = fields.Get("Original-Recipient")
+			}
+			if address := normalizeAddress(recipient); address != "" && action == "failed" && strings.HasPrefix(status, "5") {
+				bounces = append(bounces, Bounce{
+					Address:    address,
+					Reason:     models.SuppressHardBounce,
+					Status:     status,
+					Diagnostic: strings.TrimSpace(fields.Get("Diagnostic-Code")),
+				})
+			}
+		}
+		if err != nil {
+			return bounces
+		}
+	}
+}
+
+// normalizeAddress reads "rfc822; user@example.com", "<user@example.com>"
+// or "Name <user@example.com>" as a lowercased bare address
+func normalizeAddress(value string) string {
+	if addrType, address, ok := strings.Cut(value, ";"); ok && !strings.Contains(addrType, "@") {
+		value = address
+	}
+	value = strings.TrimSpace(value)
+	if parsed, err := netmail.ParseAddress(value); err == nil {
+		value = parsed.Address
+	}
+	value = strings.ToLower(strings.Trim(value, "<> "))
+	if !strings.Contains(value, "@") {
+		return ""
+	}
+	return value
+}
+
+// Suppress stops mail to the bounced address: it is recorded, its queued
+// mail is dropped, and its user is asked to update their email. The bounce
+// is trusted as it is; reports that came in by mail go through SuppressReport.
+func (o *Outbox) Suppress(bounce Bounce) error {
+	address := normalizeAddress(bounce.Address)
+	if address == "" {
+		return nil
+	}
+
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		// A complaint is never downgraded to a bounce: the recipient asked
+		// not to be mailed, which outlasts any mailbox fix
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason", "status", "diagnostic", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+				SQL:  "email_suppressions.reason <> ? OR excluded.reason = ?",
+				Vars: []interface{}{models.SuppressComplaint, models.SuppressComplaint},
+			}}},
+		}).Create(&models.EmailSuppression{
+			Address:    address,
+			Reason:     bounce.Reason,
+			Status:     bounce.Status,
+			Diagnostic: bounce.Diagnostic,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.OutboundEmail{}).
+			Where("LOWER(recipient) = ? AND status = ?", address, models.EmailPending).
+			Update("status", models.EmailSuppressed).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("LOWER(email) = ?", address).
+			Update("email_needs_update", true).Error
+	})
+	if err == nil {
+		log.Printf("📧 Suppressed %s (%s)", address, bounce.Reason)
+	}
+	return err
+}
+
+// SuppressReport suppresses the address a parsed report names, but only if
+// the report returns an email the outbox sent to that address: the Message-ID
+// is the outbox ID. Anything else could be forged to stop someone's mail.
+func (o *Outbox) SuppressReport(bounce Bounce) (bool, error) {
+	id, err := outboxID(bounce.MessageID)
+	if err != nil {
+		log.Printf("📧 Ignored report for %s: no Message-ID of ours (%q)", bounce.Address, bounce.MessageID)
+		return false, nil
+	}
+
+	var count int64
+	if err := o.DB.Model(&models.OutboundEmail{}).
+		Where("id = ? AND LOWER(recipient) = ? AND status IN ?", id, normalizeAddress(bounce.Address),
+			[]string{models.EmailSent, models.EmailSending}).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		log.Printf("📧 Ignored report for %s: %s was not sent to it", bounce.Address, bounce.MessageID)
+		return false, nil
+	}
+
+	return true, o.Suppress(bounce)
+}
+
+// outboxID reads the outbox ID out of a Message-ID, "<id@domain>"
+func outboxID(messageID string) (uuid.UUID, error) {
+	local, _, _ := strings.Cut(strings.Trim(messageID, "<> \t"), "@")
+	return uuid.Parse(local)
+}
+
+// Suppressed reports whether mail to the address is stopped. Callers must
+// not send when it fails: an unknown answer is treated as suppressed.
+func (o *Outbox) Suppressed(address string) (bool, error) {
+	var count int64
+	err := o.DB.Model(&models.EmailSuppression{}).Where("address = ?", normalizeAddress(address)).Count(&count).Error
+	return count > 0, err
+}
+
+// Unsuppress lets mail go to the address again, e.g. once its owner fixed the mailbox
+func (o *Outbox) Unsuppress(address string) (bool, error) {
+	address = normalizeAddress(address)
+
+	var removed bool
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("address = ?", address).Delete(&models.EmailSuppression{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected > 0
+
+		return tx.Model(&models.User{}).
+			Where("LOWER(email) = ?", address).
+			Update("email_needs_update", false).Error
+	})
+	return removed, err
+}
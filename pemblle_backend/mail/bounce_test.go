@@ -0,0 +1,178 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"prswjo/models"
+	"prswjo/utils"
+)
+
+// fixtureMessageID is the Message-ID of the original in every testdata report
+const fixtureMessageID = "<0b4e6a52-3c1e-4f43-9a55-2f6c1c7a8d10@pemblle.com>"
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Bounce
+	}{
+		{
+			// The delayed recipient in the same report is still being retried
+			"hard-bounce.eml",
+			[]Bounce{{
+				Address:    "gone@example.com",
+				Reason:     models.SuppressHardBounce,
+				Status:     "5.1.1",
+				Diagnostic: "smtp; 550 5.1.1 <gone@example.com>: Recipient address rejected: User unknown",
+				MessageID:  fixtureMessageID,
+			}},
+		},
+		{"delay.eml", nil},
+		{
+			// Original-Rcpt-To wins over the forwarded message's To
+			"complaint.eml",
+			[]Bounce{{Address: "annoyed@example.net", Reason: models.SuppressComplaint, Diagnostic: "Feedback-Type: abuse", MessageID: fixtureMessageID}},
+		},
+		{
+			"complaint-without-rcpt.eml",
+			[]Bounce{{Address: "annoyed@example.net", Reason: models.SuppressComplaint, Diagnostic: "Feedback-Type: abuse", MessageID: fixtureMessageID}},
+		},
+	}
+	for _, tt := range tests {
+		file, err := os.Open(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseReport(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestParseReportIgnoresOtherMail(t *testing.T) {
+	msg := "From: someone@example.com\r\nTo: bounces@pemblle.com\r\nSubject: Out of office\r\nContent-Type: text/plain\r\n\r\nI'm away until Monday.\r\n"
+	bounces, err := ParseReport(strings.NewReader(msg))
+	if err != nil || len(bounces) != 0 {
+		t.Errorf("got %v, %v; want no bounces", bounces, err)
+	}
+}
+
+func TestSuppressKeepsComplaints(t *testing.T) {
+	o, mailer := newTestOutbox(t)
+
+	if err := o.Suppress(Bounce{Address: "annoyed@example.net", Reason: models.SuppressComplaint}); err != nil {
+		t.Fatal(err)
+	}
+	// A bounce arriving later must not turn the complaint into a bounce that
+	// an admin might lift once the mailbox works again
+	if err := o.Suppress(Bounce{Address: "Annoyed@example.net", Reason: models.SuppressHardBounce, Status: "5.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var suppression models.EmailSuppression
+	if err := o.DB.First(&suppression, "address = ?", "annoyed@example.net").Error; err != nil {
+		t.Fatal(err)
+	}
+	if suppression.Reason != models.SuppressComplaint {
+		t.Errorf("reason %q, want %q", suppression.Reason, models.SuppressComplaint)
+	}
+
+	// A later complaint still replaces a bounce
+	o.Suppress(Bounce{Address: "gone@example.com", Reason: models.SuppressHardBounce, Status: "5.1.1"})
+	o.Suppress(Bounce{Address: "gone@example.com", Reason: models.SuppressComplaint})
+	if err := o.DB.First(&suppression, "address = ?", "gone@example.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	if suppression.Reason != models.SuppressComplaint {
+		t.Errorf("reason %q, want %q", suppression.Reason, models.SuppressComplaint)
+	}
+
+	// Neither address is mailed
+	for _, to := range []string{"annoyed@example.net", "gone@example.com"} {
+		if err := o.Enqueue("suppressed:"+to, utils.Email{To: to, Subject: "Hi", HTML: "<p>Hi</p>"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	if sent := mailer.Sent(); len(sent) != 0 {
+		t.Errorf("sent %d emails to suppressed addresses", len(sent))
+	}
+}
+
+func TestSuppressedFailsClosed(t *testing.T) {
+	o, mailer := newTestOutbox(t)
+
+	if err := o.Enqueue("closed:1", utils.Email{To: "someone@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	email := outboundEmail(t, o, "closed:1")
+	email.Attempts = 1
+
+	// Without the suppression list there's no telling whether to send
+	if err := o.DB.Migrator().DropTable(&models.EmailSuppression{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Suppressed("someone@example.com"); err == nil {
+		t.Fatal("Suppressed without a suppression table: want an error")
+	}
+	if err := o.Enqueue("closed:2", utils.Email{To: "someone@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}); err == nil {
+		t.Error("Enqueue without a suppression table: want an error")
+	}
+
+	o.deliver(email)
+	if len(mailer.Sent()) != 0 {
+		t.Error("email was sent although suppression could not be checked")
+	}
+	stored := outboundEmail(t, o, "closed:1")
+	if stored.Status != models.EmailPending || !strings.Contains(stored.LastError, "check suppression") {
+		t.Errorf("stored as %s with error %q, want it pending a retry", stored.Status, stored.LastError)
+	}
+}
+
+func TestSuppressReport(t *testing.T) {
+	o, _ := newTestOutbox(t)
+
+	if err := o.Enqueue("report:1", utils.Email{To: "Gone@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	sent := outboundEmail(t, o, "report:1")
+	messageID := "<" + sent.ID.String() + "@pemblle.com>"
+
+	tests := []struct {
+		name   string
+		bounce Bounce
+		want   bool
+	}{
+		{"no Message-ID", Bounce{Address: "gone@example.com", Reason: models.SuppressHardBounce}, false},
+		{"someone else's Message-ID", Bounce{Address: "gone@example.com", Reason: models.SuppressHardBounce, MessageID: fixtureMessageID}, false},
+		{"our email, another recipient", Bounce{Address: "victim@example.com", Reason: models.SuppressComplaint, MessageID: messageID}, false},
+		{"our email", Bounce{Address: "gone@example.com", Reason: models.SuppressHardBounce, MessageID: messageID}, true},
+	}
+	for _, tt := range tests {
+		ok, err := o.SuppressReport(tt.bounce)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		suppressed, err := o.Suppressed(tt.bounce.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want || suppressed != tt.want {
+			t.Errorf("%s: SuppressReport %v, suppressed %v; want %v", tt.name, ok, suppressed, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"prswjo/utils"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer writes each email to Dir as an .eml file instead of sending it,
+// for development. Mail clients open them directly.
+type FileMailer struct {
+	Dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+// Send writes the email, named so a directory listing sorts oldest first
+func (m *FileMailer) Send(email utils.Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000"), uuid.NewString()[:8])
+	path := filepath.Join(m.Dir, name)
+
+	if err := os.WriteFile(path, buildMessage(sender(fromAddress()), email), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("📧 Wrote email to %s subject: %s → %s", email.To, email.Subject, path)
+	return nil
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// IngestMaildir reads bounce and complaint reports delivered to a Maildir,
+// such as the one the Return-Path address delivers to. Messages in new/ are
+// moved to cur/ once read, whether or not they were reports; a database
+// error leaves them for the next run. Only reports returning mail we sent
+// suppress anything (see SuppressReport).
+func (o *Outbox) IngestMaildir(dir string) error {
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, "new", entry.Name())
+
+		bounces, err := readReportFile(path)
+		if err != nil {
+			log.Printf("❌ Could not read bounce report %s: %v", entry.Name(), err)
+		}
+		for _, bounce := range bounces {
+			if _, err := o.SuppressReport(bounce); err != nil {
+				return err
+			}
+		}
+
+		// ":2,S" marks it seen, as mail clients do
+		if err := os.Rename(path, filepath.Join(dir, "cur", entry.Name()+":2,S")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readReportFile parses one message file with ParseReport
+func readReportFile(path string) ([]Bounce, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseReport(file)
+}
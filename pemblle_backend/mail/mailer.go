@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"prswjo/utils"
+
+	"github.com/google/uuid"
+)
+
+// Mailer delivers one rendered email
+type Mailer interface {
+	Send(email utils.Email) error
+}
+
+// FromEnv picks the mailer named by MAIL_BACKEND: smtp (the default), file
+// for development, which drops .eml files in MAIL_DIR, or memory. Without
+// SMTP_HOST and SMTP_PORT the smtp backend falls back to file, so a
+// development setup runs without a mail server.
+func FromEnv() (Mailer, error) {
+	switch backend := strings.ToLower(os.Getenv("MAIL_BACKEND")); backend {
+	case "", "smtp":
+		m, err := SMTPFromEnv()
+		if errors.Is(err, ErrSMTPNotConfigured) {
+			log.Printf("⚠️ SMTP_HOST or SMTP_PORT is not set; writing email to %s instead of sending it", mailDir())
+			return NewFileMailer(mailDir())
+		}
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case "file":
+		return NewFileMailer(mailDir())
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q", backend)
+	}
+}
+
+// mailDir is where the file backend writes: MAIL_DIR, else ./mail_out
+func mailDir() string {
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return dir
+	}
+	return "./mail_out"
+}
+
+// fromAddress is the sender address: SMTP_FROM, else the SMTP login
+func fromAddress() string {
+	if from := os.Getenv("SMTP_FROM"); from != "" {
+		return from
+	}
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		return user
+	}
+	return "noreply@localhost"
+}
+
+// sender is the From header every backend writes, its name encoded for
+// non-ASCII site names
+func sender(address string) string {
+	fromName := os.Getenv("SMTP_FROM_NAME")
+	if fromName == "" {
+		fromName = "PemBlle"
+	}
+	return (&netmail.Address{Name: fromName, Address: address}).String()
+}
+
+// buildMessage renders the email as a MIME message: multipart/alternative
+// with the text part first, as clients show the last part they understand.
+// A List-Unsubscribe header is added when the email has an unsubscribe URL;
+// RFC 8058 also needs it covered by the DKIM signature, which the relay adds.
+func buildMessage(from string, email utils.Email) []byte {
+	messageID := email.MessageID
+	if messageID == "" {
+		messageID = uuid.NewString()
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	writePart(parts, "text/plain", email.Text)
+	writePart(parts, "text/html", email.HTML)
+	parts.Close()
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", email.To)
+	header("Subject", encodeHeader(email.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", messageID, domain))
+	if email.Unsubscribe != "" {
+		header("List-Unsubscribe", "<"+email.Unsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes()
+}
+
+// writePart adds a UTF-8 part, quoted-printable so no line is too long for SMTP
+func writePart(parts *multipart.Writer, contentType, content string) {
+	part, _ := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(strings.ReplaceAll(content, "\r\n", "\n")))
+	qp.Close()
+}
+
+// encodeHeader RFC 2047-encodes non-ASCII text such as Arabic and Kurdish
+// subjects, folding the encoded words onto continuation lines
+func encodeHeader(value string) string {
+	return strings.ReplaceAll(mime.BEncoding.Encode("UTF-8", value), "?= =?", "?=\r\n =?")
+}
@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"prswjo/utils"
+)
+
+func TestFromEnvFallsBackToFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	t.Setenv("MAIL_BACKEND", "")
+	t.Setenv("MAIL_DIR", dir)
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PORT", "")
+
+	mailer, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv without SMTP settings: %v", err)
+	}
+	file, ok := mailer.(*FileMailer)
+	if !ok {
+		t.Fatalf("got %T, want *FileMailer", mailer)
+	}
+
+	if err := file.Send(utils.Email{To: "someone@example.com", Subject: "Hi", HTML: "<p>Hi</p>", Text: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%s has %d files, want 1", dir, len(files))
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_SECURITY", "")
+	t.Setenv("SMTP_AUTH", "")
+
+	tests := []struct {
+		backend string
+		want    string // Type name, empty for an error
+	}{
+		{"", "*mail.SMTPMailer"},
+		{"smtp", "*mail.SMTPMailer"},
+		{"memory", "*mail.MemoryMailer"},
+		{"carrier-pigeon", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("MAIL_BACKEND", tt.backend)
+		mailer, err := FromEnv()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("MAIL_BACKEND=%q: want an error", tt.backend)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MAIL_BACKEND=%q: %v", tt.backend, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", mailer); got != tt.want {
+			t.Errorf("MAIL_BACKEND=%q: got %s, want %s", tt.backend, got, tt.want)
+		}
+	}
+
+	// A misconfigured server is still an error, not a silent fallback
+	t.Setenv("MAIL_BACKEND", "smtp")
+	t.Setenv("SMTP_SECURITY", "ssl3")
+	if _, err := FromEnv(); err == nil {
+		t.Error("SMTP_SECURITY=ssl3: want an error")
+	}
+}
@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"sync"
+
+	"prswjo/utils"
+)
+
+// MemoryMailer records email instead of sending it, for tests
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []utils.Email
+	err  error
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(email utils.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+// Sent returns the emails sent so far, oldest first
+func (m *MemoryMailer) Sent() []utils.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]utils.Email(nil), m.sent...)
+}
+
+// Reset forgets the emails sent so far
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = nil
+}
+
+// Fail makes every later Send return err, to exercise retries; nil heals it
+func (m *MemoryMailer) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
@@ -0,0 +1,210 @@
+// Package mail is the durable email outbox. Mail is queued in the database
+// and sent by a pool of workers that retry with backoff, so a failed send or
+// a crash doesn't lose it.
+package mail
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Retry and polling knobs
+const (
+	maxAttempts  = 8                // Then the email is dead-lettered
+	firstBackoff = 30 * time.Second // Doubles after every failed attempt
+	maxBackoff   = 2 * time.Hour
+	lease        = 5 * time.Minute // A crashed worker's email is picked up again after this
+	pollInterval = 2 * time.Second // How often idle workers look for mail
+)
+
+// Outbox queues email and sends it in the background through Mailer
+type Outbox struct {
+	DB     *gorm.DB
+	Mailer Mailer
+}
+
+func NewOutbox(db *gorm.DB, mailer Mailer) *Outbox {
+	return &Outbox{DB: db, Mailer: mailer}
+}
+
+// Enqueue stores an email for sending. key identifies the event it's about;
+// an email whose key is already queued or sent is dropped, so retried
+// requests and job runs never mail twice. Mail to a suppressed address is
+// stored but never sent.
+func (o *Outbox) Enqueue(key string, email utils.Email) error {
+	if key == "" {
+		key = uuid.NewString()
+	}
+
+	suppressed, err := o.Suppressed(email.To)
+	if err != nil {
+		return err
+	}
+	status := models.EmailPending
+	if suppressed {
+		status = models.EmailSuppressed
+	}
+
+	return o.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "idempotency_key"}},
+		DoNothing: true,
+	}).Create(&models.OutboundEmail{
+		IdempotencyKey: key,
+		Recipient:      email.To,
+		Subject:        email.Subject,
+		HTML:           email.HTML,
+		Text:           email.Text,
+		Unsubscribe:    email.Unsubscribe,
+		Status:         status,
+		NextAttemptAt:  time.Now(),
+	}).Error
+}
+
+// Start runs workers goroutines sending due email for the lifetime of the process
+func (o *Outbox) Start(workers int) {
+	queue := make(chan models.OutboundEmail)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for email := range queue {
+				o.deliver(email)
+			}
+		}()
+	}
+
+	go func() {
+		for {
+			emails, err := o.claim(workers)
+			if err != nil {
+				log.Printf("❌ Could not claim outbound email: %v", err)
+			}
+			for _, email := range emails {
+				queue <- email
+			}
+			if len(emails) < workers {
+				time.Sleep(pollInterval)
+			}
+		}
+	}()
+}
+
+// SendDue sends every email that is due right now and returns once they are
+// done, for tests and scripts that don't start workers
+func (o *Outbox) SendDue() error {
+	for {
+		emails, err := o.claim(10)
+		if err != nil || len(emails) == 0 {
+			return err
+		}
+		for _, email := range emails {
+			o.deliver(email)
+		}
+	}
+}
+
+// claimSQL takes due emails, plus any whose worker's lease ran out, and
+// leases them. SKIP LOCKED lets several processes share the outbox.
+const claimSQL = `
+UPDATE outbound_emails SET
+	status = @sending,
+	locked_until = @locked_until,
+	attempts = attempts + 1,
+	updated_at = @now
+WHERE id IN (
+	SELECT id FROM outbound_emails
+	WHERE (status = @pending AND next_attempt_at <= @now)
+		OR (status = @sending AND locked_until < @now)
+	ORDER BY next_attempt_at
+	LIMIT @limit
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+
+// claim leases up to limit due emails
+func (o *Outbox) claim(limit int) ([]models.OutboundEmail, error) {
+	now := time.Now()
+
+	var emails []models.OutboundEmail
+	err := o.DB.Raw(claimSQL, map[string]interface{}{
+		"sending":      models.EmailSending,
+		"pending":      models.EmailPending,
+		"locked_until": now.Add(lease),
+		"now":          now,
+		"limit":        limit,
+	}).Scan(&emails).Error
+	return emails, err
+}
+
+// deliver sends one leased email and records the outcome
+func (o *Outbox) deliver(email models.OutboundEmail) {
+	// The address may have bounced since the email was queued. If that
+	// can't be checked the email isn't sent, and is retried like a failed send.
+	suppressed, err := o.Suppressed(email.Recipient)
+	if suppressed {
+		o.DB.Model(&models.OutboundEmail{}).Where("id = ?", email.ID).
+			Updates(map[string]interface{}{"status": models.EmailSuppressed, "locked_until": nil})
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("check suppression: %w", err)
+	} else {
+		err = o.Mailer.Send(utils.Email{
+			To:          email.Recipient,
+			Subject:     email.Subject,
+			HTML:        email.HTML,
+			Text:        email.Text,
+			Unsubscribe: email.Unsubscribe,
+			MessageID:   email.ID.String(), // Stays the same across retries
+		})
+	}
+	now := time.Now()
+
+	updates := map[string]interface{}{"locked_until": nil}
+	switch {
+	case err == nil:
+		updates["status"] = models.EmailSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case email.Attempts >= maxAttempts:
+		updates["status"] = models.EmailDead
+		updates["last_error"] = err.Error()
+		log.Printf("❌ Giving up on email %s to %s after %d attempts: %v", email.ID, email.Recipient, email.Attempts, err)
+	default:
+		updates["status"] = models.EmailPending
+		updates["next_attempt_at"] = now.Add(backoff(email.Attempts))
+		updates["last_error"] = err.Error()
+		log.Printf("❌ Email %s to %s failed (attempt %d): %v", email.ID, email.Recipient, email.Attempts, err)
+	}
+
+	if err := o.DB.Model(&models.OutboundEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+		log.Printf("❌ Could not update outbound email %s: %v", email.ID, err)
+	}
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	wait := firstBackoff << (attempts - 1)
+	if wait > maxBackoff || wait <= 0 {
+		return maxBackoff
+	}
+	return wait
+}
+
+// Retry puts a dead (or pending) email back in the queue with a fresh set of attempts
+func (o *Outbox) Retry(id uuid.UUID) (bool, error) {
+	result := o.DB.Model(&models.OutboundEmail{}).
+		Where("id = ? AND status IN ?", id, []string{models.EmailDead, models.EmailPending}).
+		Updates(map[string]interface{}{
+			"status":          models.EmailPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
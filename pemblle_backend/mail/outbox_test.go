@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"errors"
+	"testing"
+
+	"prswjo/models"
+	"prswjo/testdb"
+	"prswjo/utils"
+)
+
+func newTestOutbox(t *testing.T) (*Outbox, *MemoryMailer) {
+	t.Helper()
+	mailer := NewMemoryMailer()
+	return NewOutbox(testdb.Open(t), mailer), mailer
+}
+
+func outboundEmail(t *testing.T, o *Outbox, key string) models.OutboundEmail {
+	t.Helper()
+	var email models.OutboundEmail
+	if err := o.DB.First(&email, "idempotency_key = ?", key).Error; err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+func TestOutboxSends(t *testing.T) {
+	o, mailer := newTestOutbox(t)
+
+	email := utils.Email{To: "someone@example.com", Subject: "Hi", HTML: "<p>Hi</p>", Text: "Hi", Unsubscribe: "https://example.com/u"}
+	for i := 0; i < 2; i++ {
+		// The second enqueue is a retried request and must not mail twice
+		if err := o.Enqueue("welcome:1", email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := mailer.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	stored := outboundEmail(t, o, "welcome:1")
+	if sent[0].To != email.To || sent[0].Subject != email.Subject || sent[0].Text != email.Text || sent[0].Unsubscribe != email.Unsubscribe {
+		t.Errorf("sent %+v, want %+v", sent[0], email)
+	}
+	if sent[0].MessageID != stored.ID.String() {
+		t.Errorf("Message-ID %q, want the outbox ID %s", sent[0].MessageID, stored.ID)
+	}
+	if stored.Status != models.EmailSent || stored.SentAt == nil || stored.Attempts != 1 {
+		t.Errorf("stored as %s after %d attempts, sent at %v", stored.Status, stored.Attempts, stored.SentAt)
+	}
+
+	// Nothing is left to send
+	mailer.Reset()
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Sent()) != 0 {
+		t.Error("sent email was sent again")
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	o, mailer := newTestOutbox(t)
+	mailer.Fail(errors.New("connection refused"))
+
+	if err := o.Enqueue("retry:1", utils.Email{To: "someone@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := outboundEmail(t, o, "retry:1")
+	if stored.Status != models.EmailPending || stored.Attempts != 1 || stored.LastError != "connection refused" {
+		t.Fatalf("after a failure: %s, %d attempts, error %q", stored.Status, stored.Attempts, stored.LastError)
+	}
+	if !stored.NextAttemptAt.After(stored.UpdatedAt) {
+		t.Error("failed email was not backed off")
+	}
+
+	// Once attempts run out the email is dead-lettered
+	o.DB.Model(&stored).Updates(map[string]interface{}{"attempts": maxAttempts - 1, "next_attempt_at": stored.CreatedAt})
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	if stored = outboundEmail(t, o, "retry:1"); stored.Status != models.EmailDead {
+		t.Fatalf("after %d attempts: %s", stored.Attempts, stored.Status)
+	}
+
+	// An admin retry sends it once the mailer works again
+	mailer.Fail(nil)
+	if ok, err := o.Retry(stored.ID); err != nil || !ok {
+		t.Fatalf("Retry: %v, %v", ok, err)
+	}
+	if err := o.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Sent()) != 1 || outboundEmail(t, o, "retry:1").Status != models.EmailSent {
+		t.Error("retried email was not sent")
+	}
+}
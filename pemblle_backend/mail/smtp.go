@@ -0,0 +1,203 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"prswjo/utils"
+)
+
+// Connection security of an SMTP server
+const (
+	SecurityTLS      = "tls"      // Implicit TLS from the first byte, usually port 465
+	SecurityStartTLS = "starttls" // Plain connection upgraded with STARTTLS, usually port 587
+	SecurityNone     = "none"     // Local relays and test servers only
+)
+
+// SMTP authentication mechanisms
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string // Envelope and header sender address; SMTP_FROM, else SMTP_USER
+	Security string
+	Auth     string
+}
+
+// ErrSMTPNotConfigured means SMTP_HOST or SMTP_PORT is unset
+var ErrSMTPNotConfigured = errors.New("SMTP configuration incomplete")
+
+// SMTPFromEnv configures an SMTPMailer from SMTP_* variables. SMTP_SECURITY
+// defaults to tls on port 465 and starttls elsewhere; SMTP_AUTH to plain.
+func SMTPFromEnv() (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASS"),
+		From:     fromAddress(),
+		Security: strings.ToLower(os.Getenv("SMTP_SECURITY")),
+		Auth:     strings.ToLower(os.Getenv("SMTP_AUTH")),
+	}
+	if m.Security == "" {
+		m.Security = SecurityStartTLS
+		if m.Port == "465" {
+			m.Security = SecurityTLS
+		}
+	}
+	if m.Auth == "" {
+		m.Auth = AuthPlain
+	}
+
+	if m.Host == "" || m.Port == "" {
+		return nil, ErrSMTPNotConfigured
+	}
+	switch m.Security {
+	case SecurityTLS, SecurityStartTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_SECURITY %q", m.Security)
+	}
+	switch m.Auth {
+	case AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_AUTH %q", m.Auth)
+	}
+
+	return m, nil
+}
+
+// Send delivers one email in its own SMTP session
+func (m *SMTPMailer) Send(email utils.Email) error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Auth != AuthNone {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server does not support AUTH")
+		}
+		if err := client.Auth(m.auth()); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(email.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(sender(m.From), email)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("📧 Sent email to %s subject: %s", email.To, email.Subject)
+	return client.Quit()
+}
+
+// dial opens a session secured as configured
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.Host, m.Port)
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp: server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// auth returns the configured mechanism. net/smtp refuses PLAIN and LOGIN
+// credentials over an unencrypted connection to anything but localhost.
+func (m *SMTPMailer) auth() smtp.Auth {
+	switch m.Auth {
+	case AuthLogin:
+		return &loginAuth{username: m.Username, password: m.Password, host: m.Host}
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(m.Username, m.Password)
+	default:
+		return smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+}
+
+// loginAuth is the LOGIN mechanism, which some providers still require
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("smtp: unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("smtp: wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("smtp: unexpected LOGIN challenge %q", fromServer)
+	}
+}
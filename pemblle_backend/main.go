@@ -3,10 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"prswjo/handlers"
+	"prswjo/jobs"
+	"prswjo/mail"
 	"prswjo/middleware"
 	"prswjo/models"
+	"prswjo/notify"
 	"prswjo/ws"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,6 +22,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// emailWorkers is how many emails are sent at once
+const emailWorkers = 4
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -35,8 +42,9 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Auto Migrate
-	db.AutoMigrate(&models.User{}, &models.PendingUser{}, &models.Tell{}, &models.Answer{}, &models.Reply{}, &models.Follow{}, &models.Chat{}, &models.Message{})
+	if err := models.Migrate(db); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
 
 	app := fiber.New()
 
@@ -52,8 +60,17 @@ func main() {
 		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
 	}))
 
+	// Outbound email is queued in the database and sent by background workers
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure mail:", err)
+	}
+	outbox := mail.NewOutbox(db, mailer)
+	outbox.Start(emailWorkers)
+	notifier := notify.NewService(db, outbox)
+
 	// Handlers
-	authHandler := handlers.NewAuthHandler(db)
+	authHandler := handlers.NewAuthHandler(db, outbox)
 
 	// Routes
 	api := app.Group("/api")
@@ -63,13 +80,16 @@ func main() {
 	auth.Post("/login", authHandler.Login)
 	auth.Get("/verify/:token", authHandler.VerifyEmail)
 	auth.Post("/resend-verification", authHandler.ResendVerification)
+	auth.Get("/email/verify/:token", authHandler.VerifyEmailChange)
 
 	// User Routes
-	userHandler := handlers.NewUserHandler(db)
-	api.Get("/users", userHandler.GetUsers)
+	userHandler := handlers.NewUserHandler(db, notifier)
+	api.Get("/users", middleware.OptionalAuth(), userHandler.GetUsers)
 	api.Put("/users/profile", middleware.Protected(), userHandler.UpdateProfile)
 	api.Post("/users/avatar", middleware.Protected(), userHandler.UploadAvatar)
 	api.Put("/auth/password", middleware.Protected(), authHandler.ChangePassword)
+	api.Put("/auth/email", middleware.Protected(), authHandler.ChangeEmail)
+	api.Get("/users/suggestions", middleware.Protected(), userHandler.GetSuggestions)
 	api.Get("/users/:username", userHandler.GetUserByUsername)
 
 	// Follow Routes
@@ -80,15 +100,29 @@ func main() {
 	api.Get("/users/:id/follow-status", middleware.Protected(), userHandler.CheckFollowStatus)
 	api.Get("/users/:id/follow-counts", userHandler.GetFollowCounts)
 
+	// Block Routes
+	api.Get("/blocks", middleware.Protected(), userHandler.GetBlockedUsers)
+	api.Post("/users/:id/block", middleware.Protected(), userHandler.BlockUser)
+	api.Delete("/users/:id/block", middleware.Protected(), userHandler.UnblockUser)
+
 	// Serve uploaded files
+	handlers.RemoveLegacyCardCache()
 	app.Static("/uploads", "./uploads")
 
 	// Tell Routes
-	tellHandler := handlers.NewTellHandler(db)
+	tellHandler := handlers.NewTellHandler(db, notifier)
 
 	// Public tell routes (Must be defined before protected group or use different prefix)
-	api.Get("/public/tells/:username", tellHandler.GetUserTells)
-	api.Get("/public/feed", tellHandler.GetPublicFeed)
+	api.Get("/public/tells/:username", middleware.OptionalAuth(), tellHandler.GetUserTells)
+	api.Get("/public/feed", middleware.OptionalAuth(), tellHandler.GetPublicFeed)
+	api.Get("/public/answers/:id/revisions", tellHandler.GetAnswerRevisions)
+	api.Get("/public/answers/:id/likes", tellHandler.GetAnswerLikes)
+	api.Get("/public/answers/:id/card.png", tellHandler.GetAnswerCard)
+	api.Get("/public/tags/trending", tellHandler.GetTrendingTags)
+	api.Get("/public/tags/:tag", middleware.OptionalAuth(), tellHandler.GetTagAnswers)
+	api.Get("/public/search", middleware.OptionalAuth(), tellHandler.Search)
+	api.Get("/public/users/:username/feed.atom", tellHandler.GetUserAtomFeed)
+	api.Get("/public/users/:username/feed.rss", tellHandler.GetUserRSSFeed)
 	api.Post("/public/tells", tellHandler.CreatePublicTell) // Anonymous users can send tells
 
 	tells := api.Group("/tells")
@@ -97,11 +131,54 @@ func main() {
 	tells.Get("/", tellHandler.GetTells)
 	tells.Get("/sent", tellHandler.GetSentTells)
 	tells.Get("/unread-count", tellHandler.GetUnansweredCount)
+	tells.Get("/trash", tellHandler.GetDeletedTells)
+	tells.Post("/bulk", tellHandler.BulkTellAction)
+	tells.Delete("/:id", tellHandler.DeleteTell)
+	tells.Post("/:id/restore", tellHandler.RestoreTell)
+	tells.Post("/:id/archive", tellHandler.ArchiveTell)
+	tells.Delete("/:id/archive", tellHandler.UnarchiveTell)
 	tells.Post("/:id/answer", tellHandler.AnswerTell)
+	tells.Delete("/:id/answer", tellHandler.DeleteAnswer)
+	tells.Put("/answers/:id", tellHandler.EditAnswer)
 	tells.Post("/answers/:id/reply", tellHandler.ReplyToAnswer)
+	tells.Post("/answers/:id/like", tellHandler.ToggleLike)
+	tells.Post("/answers/:id/pin", tellHandler.PinAnswer)
+	tells.Delete("/answers/:id/pin", tellHandler.UnpinAnswer)
+	tells.Put("/pins", tellHandler.ReorderPins)
+
+	// Permanently remove tells that have been in the trash past the restore window
+	jobs.Every("purge-deleted-tells", time.Hour, tellHandler.PurgeDeletedTells)
+
+	// Recompute every user's ranked "For You" feed
+	jobs.Every("rank-feeds", 15*time.Minute, tellHandler.RefreshRankedFeeds)
+
+	// Recount trending hashtags for every window
+	jobs.Every("trending-tags", 10*time.Minute, tellHandler.RefreshTrendingTags)
+
+	// Build search documents for answers written before search existed
+	jobs.Every("index-answers", 5*time.Minute, tellHandler.IndexAnswers)
+
+	// Link previews: OpenGraph/Twitter pages and oEmbed
+	shareHandler := handlers.NewShareHandler(db)
+	api.Get("/share/users/:username", shareHandler.GetProfilePage)
+	api.Get("/share/answers/:id", shareHandler.GetAnswerPage)
+	api.Get("/oembed", shareHandler.GetOEmbed)
+
+	// ActivityPub federation, outside /api where other servers expect it
+	federationHandler := handlers.NewFederationHandler(db)
+	app.Get("/.well-known/webfinger", federationHandler.WebFinger)
+	ap := app.Group("/ap")
+	ap.Get("/actors/:id", federationHandler.GetActor)
+	ap.Get("/actors/:id/outbox", federationHandler.GetOutbox)
+	ap.Get("/actors/:id/followers", federationHandler.GetFollowers)
+	ap.Post("/actors/:id/inbox", federationHandler.Inbox)
+	ap.Get("/notes/:id", federationHandler.GetNote)
+
+	// Deliver queued activities to remote inboxes
+	jobs.Every("deliver-activities", 30*time.Second, federationHandler.DeliverActivities)
 
 	// Chat Routes
-	chatHandler := handlers.NewChatHandler(db)
+	chatHandler := handlers.NewChatHandler(db, notifier)
 	chats := api.Group("/chats")
 	chats.Use(middleware.Protected())
 	chats.Get("/", chatHandler.GetChats)
@@ -111,6 +188,43 @@ func main() {
 	chats.Post("/:chatId/messages", chatHandler.SendMessage)
 	chats.Put("/:chatId/read", chatHandler.MarkAsRead)
 
+	// Notification center
+	notificationHandler := handlers.NewNotificationHandler(db, notifier)
+	notifications := api.Group("/notifications")
+	notifications.Use(middleware.Protected())
+	notifications.Get("/", notificationHandler.GetNotifications)
+	notifications.Get("/unread-count", notificationHandler.GetUnreadCount)
+	notifications.Put("/read-all", notificationHandler.MarkAllRead)
+	notifications.Get("/preferences", notificationHandler.GetPreferences)
+	notifications.Put("/preferences", notificationHandler.UpdatePreferences)
+	notifications.Put("/:id/read", notificationHandler.MarkRead)
+
+	// Unsubscribe links in emails; the signed token stands in for a login
+	api.Get("/unsubscribe", notificationHandler.UnsubscribePage)
+	api.Post("/unsubscribe", notificationHandler.Unsubscribe)
+
+	// Email notifications batched into hourly, daily and weekly digests, or held by quiet hours
+	jobs.Every("email-digests", 5*time.Minute, notificationHandler.Notify.SendDigests)
+
+	// Admin tools
+	adminHandler := handlers.NewAdminHandler(db, outbox)
+	admin := api.Group("/admin")
+	admin.Use(middleware.Protected(), middleware.AdminOnly(db))
+	admin.Get("/emails", adminHandler.GetEmails)
+	admin.Get("/emails/:id", adminHandler.GetEmail)
+	admin.Post("/emails/:id/retry", adminHandler.RetryEmail)
+	admin.Get("/suppressions", adminHandler.GetSuppressions)
+	admin.Delete("/suppressions/:address", adminHandler.DeleteSuppression)
+
+	// Bounces and spam complaints stop mail to an address
+	bounceHandler := handlers.NewBounceHandler(db, outbox)
+	api.Post("/webhooks/bounces", bounceHandler.ReceiveBounce)
+	if maildir := os.Getenv("BOUNCE_MAILDIR"); maildir != "" {
+		jobs.Every("bounce-mailbox", time.Minute, func() error {
+			return outbox.IngestMaildir(maildir)
+		})
+	}
+
 	// WebSocket
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
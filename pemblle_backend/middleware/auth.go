@@ -4,28 +4,71 @@ import (
 	"os"
 	"strings"
 
+	"prswjo/models"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
+// userIDFromToken returns the user_id claim of a valid bearer token, if any
+func userIDFromToken(c *fiber.Ctx) (interface{}, bool) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return nil, false
+	}
+
+	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	return claims["user_id"], true
+}
+
 func Protected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
+		if c.Get("Authorization") == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
+		userID, ok := userIDFromToken(c)
+		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		c.Locals("user_id", claims["user_id"])
+		c.Locals("user_id", userID)
+
+		return c.Next()
+	}
+}
+
+// OptionalAuth sets user_id like Protected when a valid token is sent,
+// but lets anonymous requests (and bad tokens) through without it
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if userID, ok := userIDFromToken(c); ok {
+			c.Locals("user_id", userID)
+		}
+
+		return c.Next()
+	}
+}
+
+// AdminOnly lets through users flagged as admins. It goes after Protected.
+func AdminOnly(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+
+		var user models.User
+		if err := db.Select("id, is_admin").First(&user, "id = ?", userID).Error; err != nil || !user.IsAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Admins only"})
+		}
 
 		return c.Next()
 	}
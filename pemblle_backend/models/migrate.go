@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Migrate brings the schema up to date. It stops at the first failure, so a
+// broken model can't leave the tables after it silently unmigrated.
+func Migrate(db *gorm.DB) error {
+	// Trigram indexes back the fuzzy user search
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return fmt.Errorf("enable pg_trgm: %w", err)
+	}
+
+	// Answers from before reply_count existed get it counted once
+	backfillReplyCount := !db.Migrator().HasColumn(&Answer{}, "ReplyCount")
+
+	if err := db.AutoMigrate(
+		&User{},
+		&PendingUser{},
+		&EmailChange{},
+		&Tell{},
+		&Answer{},
+		&AnswerRevision{},
+		&Reply{},
+		&Mention{},
+		&Like{},
+		&Tag{},
+		&AnswerTag{},
+		&TrendingTag{},
+		&Follow{},
+		&Block{},
+		&Suggestion{},
+		&FeedEntry{},
+		&ActorKey{},
+		&RemoteActor{},
+		&RemoteFollower{},
+		&ActivityDelivery{},
+		&Notification{},
+		&NotificationPreference{},
+		&NotificationSettings{},
+		&DigestItem{},
+		&OutboundEmail{},
+		&EmailSuppression{},
+		&Chat{},
+		&Message{},
+	); err != nil {
+		return err
+	}
+
+	if backfillReplyCount {
+		if err := db.Exec("UPDATE answers SET reply_count = (SELECT COUNT(*) FROM replies WHERE replies.answer_id = answers.id)").Error; err != nil {
+			return fmt.Errorf("backfill reply counts: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,25 +1,40 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
 	ID                uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Username          string    `gorm:"uniqueIndex;not null" json:"username"`
-	FullName          string    `json:"full_name"`
+	Username          string    `gorm:"uniqueIndex;index:idx_users_username_trgm,type:gin,expression:username gin_trgm_ops;not null" json:"username"`
+	FullName          string    `gorm:"index:idx_users_full_name_trgm,type:gin,expression:full_name gin_trgm_ops" json:"full_name"`
 	Email             string    `gorm:"uniqueIndex;not null" json:"email"`
 	Password          string    `json:"-"`
 	Avatar            string    `json:"avatar"`
 	Bio               string    `json:"bio"`
 	IsVerified        bool      `gorm:"default:true" json:"is_verified"`
+	MentionPolicy     string    `gorm:"default:everyone;not null" json:"mention_policy"` // everyone, following or nobody
+	IsAdmin           bool      `gorm:"not null;default:false" json:"-"`                 // Set by hand in the database
+	Language          string    `gorm:"not null;default:en" json:"language"`             // Emails are written in it: en, ar or ku
+	EmailNeedsUpdate  bool      `gorm:"not null;default:false" json:"-"`                 // Mail to the address bounced or was reported as spam; only the user sees it
+	FeedViewedAt      time.Time `json:"-"`                                               // Last opened "For You"; only recent viewers' feeds are ranked
+	SuggestedAt       time.Time `json:"-"`                                               // When who-to-follow was last computed, even if it found no one
 	VerificationToken string    `json:"-"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// Who can @mention a user (User.MentionPolicy)
+const (
+	MentionEveryone  = "everyone"
+	MentionFollowing = "following" // Only people the user follows
+	MentionNobody    = "nobody"
+)
+
 // PendingUser stores registration data until email is verified
 type PendingUser struct {
 	ID                uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
@@ -28,6 +43,17 @@ type PendingUser struct {
 	Email             string    `gorm:"uniqueIndex;not null" json:"email"`
 	Password          string    `json:"-"`
 	VerificationToken string    `gorm:"uniqueIndex;not null" json:"-"`
+	Language          string    `gorm:"not null;default:en" json:"language"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// EmailChange holds a new email address until the user verifies it
+type EmailChange struct {
+	ID                uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID            uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"user_id"` // One change at a time
+	Email             string    `gorm:"not null" json:"email"`
+	VerificationToken string    `gorm:"uniqueIndex;not null" json:"-"`
 	ExpiresAt         time.Time `json:"expires_at"`
 	CreatedAt         time.Time `json:"created_at"`
 }
@@ -35,34 +61,118 @@ type PendingUser struct {
 type Tell struct {
 	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	SenderID    *uuid.UUID `gorm:"type:uuid" json:"sender_id,omitempty"` // Nullable for anonymous
-	ReceiverID  uuid.UUID  `gorm:"type:uuid;not null" json:"receiver_id"`
+	ReceiverID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"receiver_id"`
 	Receiver    *User      `gorm:"foreignKey:ReceiverID" json:"receiver,omitempty"`
 	Content     string     `gorm:"not null" json:"content"`
 	IsAnonymous bool       `gorm:"default:true" json:"is_anonymous"`
 	Answer      *Answer    `gorm:"foreignKey:TellID" json:"answer,omitempty"`
+	ArchivedAt  *time.Time `gorm:"index" json:"archived_at,omitempty"` // Hidden from the inbox, answer stays public
 	CreatedAt   time.Time  `json:"created_at"`
+	// Soft delete: restorable until purged by the background job
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 type Answer struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	TellID      uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"tell_id"`
+	Content     string     `gorm:"not null" json:"content"`
+	Replies     []Reply    `gorm:"foreignKey:AnswerID" json:"replies,omitempty"`
+	Mentions    []Mention  `gorm:"foreignKey:AnswerID" json:"mentions,omitempty"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	LikeCount   int        `gorm:"not null;default:0" json:"like_count"`  // Denormalized from likes
+	ReplyCount  int        `gorm:"not null;default:0" json:"reply_count"` // Denormalized from replies
+	LikedByMe   bool       `gorm:"-" json:"liked_by_me"`
+	PinPosition *int       `json:"pin_position,omitempty"` // Set when pinned to the receiver's profile, 0 = top
+	// Full-text search document over tell, answer and replies; written with raw SQL only
+	SearchVector string    `gorm:"type:tsvector;index:idx_answers_search,type:gin;->:false;<-:false" json:"-"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+}
+
+// Like is a single user's like on an answer
+type Like struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	TellID    uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"tell_id"`
+	AnswerID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_likes_answer_user" json:"answer_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_likes_answer_user;index" json:"user_id"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnswerRevision stores the previous content of an answer each time it is edited
+type AnswerRevision struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AnswerID  uuid.UUID `gorm:"type:uuid;not null;index" json:"answer_id"`
 	Content   string    `gorm:"not null" json:"content"`
-	Replies   []Reply   `gorm:"foreignKey:AnswerID" json:"replies,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Tag is a normalized #hashtag: lowercased, without the leading '#'
+type Tag struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnswerTag links an answer to a hashtag used in its tell or answer text
+type AnswerTag struct {
+	AnswerID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"answer_id"`
+	TagID     uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TrendingTag is a precomputed entry of the trending tags list for one time window
+type TrendingTag struct {
+	Period      string    `gorm:"primaryKey" json:"window"` // "window" is reserved in SQL
+	Rank        int       `gorm:"primaryKey;autoIncrement:false" json:"rank"`
+	TagID       uuid.UUID `gorm:"type:uuid;not null" json:"tag_id"`
+	Name        string    `gorm:"not null" json:"name"`
+	AnswerCount int64     `json:"answer_count"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
 type Reply struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	AnswerID  uuid.UUID `gorm:"type:uuid;not null" json:"answer_id"`
 	SenderID  uuid.UUID `gorm:"type:uuid;not null" json:"sender_id"`
 	Content   string    `gorm:"not null" json:"content"`
+	Mentions  []Mention `gorm:"foreignKey:ReplyID" json:"mentions,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Mention is an @username in an answer or reply, resolved to a user when it was written
+type Mention struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	AnswerID  *uuid.UUID `gorm:"type:uuid;index" json:"-"`
+	ReplyID   *uuid.UUID `gorm:"type:uuid;index" json:"-"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Username  string     `gorm:"not null" json:"username"` // The user's username at the time, whatever case the text used
+	CreatedAt time.Time  `json:"-"`
+}
+
+// FeedEntry is one precomputed row of a user's ranked "For You" feed
+type FeedEntry struct {
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Rank       int       `gorm:"primaryKey;autoIncrement:false" json:"rank"`
+	TellID     uuid.UUID `gorm:"type:uuid;not null" json:"tell_id"`
+	Score      float64   `json:"score"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// Suggestion is a cached who-to-follow recommendation with the signals behind it
+type Suggestion struct {
+	UserID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	SuggestedID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"suggested_id"`
+	Score            float64   `json:"score"`
+	FriendsOfFriends int       `json:"friends_of_friends"` // People the user follows who follow SuggestedID
+	MutualFollowers  int       `json:"mutual_followers"`   // The user's followers who also follow SuggestedID
+	FollowsYou       bool      `json:"follows_you"`
+	RecentAnswers    int       `json:"recent_answers"`
+	ComputedAt       time.Time `json:"computed_at"`
+}
+
 type Follow struct {
 	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	FollowerID  uuid.UUID `gorm:"type:uuid;not null" json:"follower_id"`
-	FollowingID uuid.UUID `gorm:"type:uuid;not null" json:"following_id"`
+	FollowerID  uuid.UUID `gorm:"type:uuid;not null;index" json:"follower_id"`
+	FollowingID uuid.UUID `gorm:"type:uuid;not null;index" json:"following_id"`
 	IsAnonymous bool      `gorm:"default:false" json:"is_anonymous"`
 	CreatedAt   time.Time `json:"created_at"`
 }
@@ -71,6 +181,149 @@ func (Follow) TableName() string {
 	return "follows"
 }
 
+// Block stops two users interacting: no tells, follows, chats, replies or mentions between them, and no suggestions of each other
+type Block struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	BlockerID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_blocks_pair" json:"blocker_id"`
+	BlockedID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_blocks_pair;index" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ActorKey is the RSA key pair a user's ActivityPub actor signs deliveries with
+type ActorKey struct {
+	UserID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	PublicKeyPEM  string    `gorm:"not null" json:"public_key_pem"`
+	PrivateKeyPEM string    `gorm:"not null" json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// RemoteActor caches an actor on another fediverse server
+type RemoteActor struct {
+	ID           string    `gorm:"primaryKey" json:"id"` // Actor URI
+	Inbox        string    `gorm:"not null" json:"inbox"`
+	SharedInbox  string    `json:"shared_inbox"`
+	PublicKeyID  string    `gorm:"index" json:"public_key_id"`
+	PublicKeyPEM string    `json:"-"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// RemoteFollower is a fediverse actor following a local user
+type RemoteFollower struct {
+	UserID    uuid.UUID    `gorm:"type:uuid;primaryKey" json:"user_id"`
+	ActorID   string       `gorm:"primaryKey" json:"actor_id"`
+	Actor     *RemoteActor `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+	FollowID  string       `json:"follow_id"` // ID of the Follow activity, for Accept
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ActivityDelivery is a signed POST of an activity to a remote inbox, retried with backoff
+type ActivityDelivery struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"` // Whose key signs it
+	Inbox         string     `gorm:"not null" json:"inbox"`
+	Payload       string     `gorm:"type:text;not null" json:"payload"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	FailedAt      *time.Time `json:"failed_at"` // Set once retries are exhausted
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Notification is one entry in a user's notification center
+type Notification struct {
+	ID      uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID  uuid.UUID  `gorm:"type:uuid;not null;index:idx_notifications_user_created,priority:1;index:idx_notifications_unread,where:read_at IS NULL" json:"user_id"`
+	Type    string     `gorm:"not null" json:"type"`                // One of notify.Types
+	ActorID *uuid.UUID `gorm:"type:uuid" json:"actor_id,omitempty"` // Nil when whoever caused it stays anonymous
+	Actor   *User      `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+	// Type-specific payload, stored as JSON; Data carries it in responses
+	Payload   string          `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	Data      json.RawMessage `gorm:"-" json:"data"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `gorm:"index:idx_notifications_user_created,priority:2" json:"created_at"`
+}
+
+// NotificationPreference overrides the default channels of one notification type for a user
+type NotificationPreference struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Type      string    `gorm:"primaryKey" json:"type"`
+	InApp     bool      `json:"in_app"`
+	WebSocket bool      `json:"websocket"`
+	Email     bool      `json:"email"`
+	Push      bool      `json:"push"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationSettings are a user's timezone, quiet hours (when email and push are held
+// back) and email digest mode
+type NotificationSettings struct {
+	UserID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Timezone          string    `gorm:"not null;default:'UTC'" json:"timezone"` // IANA name, e.g. Asia/Baghdad
+	QuietHoursEnabled bool      `json:"quiet_hours_enabled"`
+	QuietHoursStart   string    `gorm:"not null;default:'22:00'" json:"quiet_hours_start"` // HH:MM in Timezone
+	QuietHoursEnd     string    `gorm:"not null;default:'07:00'" json:"quiet_hours_end"`
+	// How notification emails are batched: immediate, hourly, daily or weekly
+	DigestMode string    `gorm:"not null;default:'immediate'" json:"digest_mode"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DigestItem is a notification waiting to go out in the user's next email digest
+type DigestItem struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Type      string     `gorm:"not null" json:"type"`
+	ActorID   *uuid.UUID `gorm:"type:uuid" json:"actor_id,omitempty"`
+	Payload   string     `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// OutboundEmail is a message in the durable email outbox, sent by the mail workers
+type OutboundEmail struct {
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	// Identifies what the email is about, so the same event is never mailed twice
+	IdempotencyKey string     `gorm:"uniqueIndex;not null" json:"idempotency_key"`
+	Recipient      string     `gorm:"not null;index" json:"recipient"`
+	Subject        string     `gorm:"not null" json:"subject"`
+	HTML           string     `gorm:"type:text;not null" json:"html,omitempty"`
+	Text           string     `gorm:"type:text" json:"text,omitempty"`
+	Unsubscribe    string     `json:"unsubscribe,omitempty"`                                                           // One-click unsubscribe URL
+	Status         string     `gorm:"not null;default:pending;index:idx_outbound_emails_due,priority:1" json:"status"` // pending, sending, sent or dead
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_outbound_emails_due,priority:2" json:"next_attempt_at"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"` // Lease of the worker sending it
+	LastError      string     `json:"last_error,omitempty"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Outbound email states (OutboundEmail.Status)
+const (
+	EmailPending    = "pending"
+	EmailSending    = "sending"
+	EmailSent       = "sent"
+	EmailDead       = "dead"       // Out of attempts; only an admin retry sends it again
+	EmailSuppressed = "suppressed" // Not sent: the address bounced or complained
+)
+
+// EmailSuppression stops all mail to an address that bounced for good or
+// reported us as spam. Addresses are stored lowercased.
+type EmailSuppression struct {
+	Address    string    `gorm:"primaryKey" json:"address"`
+	Reason     string    `gorm:"not null" json:"reason"` // hard_bounce or complaint
+	Status     string    `json:"status,omitempty"`       // DSN status code, e.g. 5.1.1
+	Diagnostic string    `json:"diagnostic,omitempty"`   // What the receiving server said
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Why an address is suppressed (EmailSuppression.Reason)
+const (
+	SuppressHardBounce = "hard_bounce"
+	SuppressComplaint  = "complaint"
+)
+
 // Chat represents a conversation between two users
 type Chat struct {
 	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/google/uuid"
+)
+
+// Digest modes: how often a user's notification emails go out
+const (
+	DigestImmediate = "immediate" // One email per event; only quiet hours hold mail back
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+	DigestWeekly    = "weekly"
+)
+
+// ValidDigestMode reports whether mode is a known digest mode
+func ValidDigestMode(mode string) bool {
+	switch mode {
+	case DigestImmediate, DigestHourly, DigestDaily, DigestWeekly:
+		return true
+	}
+	return false
+}
+
+// Daily digests go out at digestHour in the user's timezone, weekly ones on digestWeekday
+const (
+	digestHour     = 8
+	digestWeekday  = time.Monday
+	digestPreviews = 3 // Items quoted per section
+)
+
+// sectionPaths are where each section links to in the web app
+var sectionPaths = map[Type]string{
+	NewTell:  "/notifications",
+	Answered: "/notifications",
+	NewReply: "/notifications",
+	Follow:   "/profile",
+	Message:  "/chat",
+	Mention:  "/notifications",
+	Like:     "/notifications",
+}
+
+// queueDigest holds an event's email for the user's next digest
+func (s *Service) queueDigest(event Event, payload []byte) {
+	if err := s.DB.Create(&models.DigestItem{
+		UserID:  event.UserID,
+		Type:    string(event.Payload.Type()),
+		ActorID: event.ActorID,
+		Payload: string(payload),
+	}).Error; err != nil {
+		log.Printf("❌ Could not queue %s for digest: %v", event.Payload.Type(), err)
+	}
+}
+
+// digestSlot is the latest time a digest was scheduled for at or before now.
+// Items older than it are due.
+func digestSlot(settings models.NotificationSettings, now time.Time) time.Time {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+
+	switch settings.DigestMode {
+	case DigestHourly:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+	case DigestDaily, DigestWeekly:
+		slot := time.Date(local.Year(), local.Month(), local.Day(), digestHour, 0, 0, 0, loc)
+		if slot.After(local) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		for settings.DigestMode == DigestWeekly && slot.Weekday() != digestWeekday {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		return slot
+	default:
+		return now
+	}
+}
+
+// SendDigests emails every user whose digest is due, outside their quiet hours
+func (s *Service) SendDigests() error {
+	var pending []struct {
+		UserID uuid.UUID
+		Oldest time.Time
+	}
+	if err := s.DB.Model(&models.DigestItem{}).
+		Select("user_id, MIN(created_at) AS oldest").
+		Group("user_id").
+		Scan(&pending).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, p := range pending {
+		settings, err := s.Settings(p.UserID)
+		if err != nil {
+			log.Printf("❌ Could not load notification settings for %s: %v", p.UserID, err)
+			continue
+		}
+		if InQuietHours(settings, now) || !p.Oldest.Before(digestSlot(settings, now)) {
+			continue
+		}
+
+		if err := s.sendDigest(p.UserID, settings); err != nil {
+			log.Printf("❌ Could not send digest to %s: %v", p.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendDigest queues one email summarizing a user's pending items, then clears them
+func (s *Service) sendDigest(userID uuid.UUID, settings models.NotificationSettings) error {
+	var items []models.DigestItem
+	if err := s.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&items).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	var user models.User
+	if err := s.DB.Select("email, language").First(&user, "id = ?", userID).Error; err != nil || user.Email == "" {
+		// Nowhere to send them
+		return s.DB.Where("id IN ?", ids).Delete(&models.DigestItem{}).Error
+	}
+
+	names := s.actorNames(items)
+	byType := make(map[Type][]models.DigestItem)
+	for _, item := range items {
+		byType[Type(item.Type)] = append(byType[Type(item.Type)], item)
+	}
+
+	var sections []utils.DigestSection
+	for _, t := range Types {
+		group := byType[t]
+		if len(group) == 0 {
+			continue
+		}
+
+		section := utils.DigestSection{Type: string(t), Count: len(group), Link: utils.FrontendURL() + sectionPaths[t]}
+		for i, item := range group {
+			if i == digestPreviews {
+				section.More = len(group) - digestPreviews
+				break
+			}
+			section.Previews = append(section.Previews, digestPreview(item, names))
+		}
+		sections = append(sections, section)
+	}
+
+	period := settings.DigestMode
+	if period == DigestImmediate {
+		period = "" // Held back by quiet hours
+	}
+
+	to := utils.Recipient{Email: user.Email, Language: user.Language, Unsubscribe: UnsubscribeURL(userID, AllEmail)}
+
+	// The same batch of items always gets the same key, so a failed cleanup
+	// can't send it twice
+	hash := sha256.New()
+	for _, id := range ids {
+		hash.Write(id[:])
+	}
+	key := fmt.Sprintf("digest:%s:%x", userID, hash.Sum(nil)[:16])
+	if err := s.Outbox.Enqueue(key, utils.DigestEmail(to, period, len(items), sections)); err != nil {
+		return err
+	}
+
+	return s.DB.Where("id IN ?", ids).Delete(&models.DigestItem{}).Error
+}
+
+// actorNames looks up display names of everyone who caused the items
+func (s *Service) actorNames(items []models.DigestItem) map[uuid.UUID]string {
+	var actorIDs []uuid.UUID
+	for _, item := range items {
+		if item.ActorID != nil {
+			actorIDs = append(actorIDs, *item.ActorID)
+		}
+	}
+
+	names := make(map[uuid.UUID]string)
+	if len(actorIDs) == 0 {
+		return names
+	}
+
+	var actors []models.User
+	s.DB.Select("id, username, full_name").Where("id IN ?", actorIDs).Find(&actors)
+	for _, actor := range actors {
+		names[actor.ID] = actor.FullName
+		if names[actor.ID] == "" {
+			names[actor.ID] = actor.Username
+		}
+	}
+	return names
+}
+
+// digestPreview quotes an item, naming the actor unless anonymous
+func digestPreview(item models.DigestItem, names map[uuid.UUID]string) utils.DigestPreview {
+	var payload struct {
+		Preview string `json:"preview"`
+	}
+	json.Unmarshal([]byte(item.Payload), &payload)
+
+	preview := utils.DigestPreview{Type: item.Type, Quote: payload.Preview}
+	if item.ActorID != nil {
+		preview.Actor = names[*item.ActorID]
+	}
+	return preview
+}
@@ -0,0 +1,245 @@
+// Package notify is the one place notifications are sent from. Handlers
+// describe what happened; the service stores it in the user's notification
+// center and fans it out over WebSocket and email, as the user's
+// preferences allow.
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"prswjo/mail"
+	"prswjo/models"
+	"prswjo/utils"
+	"prswjo/ws"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Type identifies what a notification is about. The values double as the
+// WebSocket frame types clients already listen for.
+type Type string
+
+const (
+	NewTell  Type = "new_tell"
+	Answered Type = "tell_answered"
+	NewReply Type = "new_reply"
+	Follow   Type = "new_follower"
+	Message  Type = "new_message"
+	Mention  Type = "mention"
+	Like     Type = "answer_liked"
+)
+
+// Types lists every notification type
+var Types = []Type{NewTell, Answered, NewReply, Follow, Message, Mention, Like}
+
+// previewLength caps the text previews stored in payloads
+const previewLength = 120
+
+// Payload is the typed body of a notification, stored as JSON
+type Payload interface {
+	Type() Type
+	// EventID is the ID of what happened (the tell, reply, follow...), which
+	// keeps its email from being sent twice
+	EventID() uuid.UUID
+}
+
+// NewTellPayload: someone sent the user a tell
+type NewTellPayload struct {
+	TellID  uuid.UUID `json:"tell_id"`
+	Preview string    `json:"preview"`
+}
+
+// AnsweredPayload: a tell the user sent was answered
+type AnsweredPayload struct {
+	TellID   uuid.UUID `json:"tell_id"`
+	AnswerID uuid.UUID `json:"answer_id"`
+	Preview  string    `json:"preview"`
+}
+
+// NewReplyPayload: the other side of a tell replied under its answer
+type NewReplyPayload struct {
+	TellID  uuid.UUID `json:"tell_id"`
+	ReplyID uuid.UUID `json:"reply_id"`
+	Preview string    `json:"preview"`
+}
+
+// FollowPayload: someone followed the user
+type FollowPayload struct {
+	FollowID  uuid.UUID `json:"follow_id"`
+	Anonymous bool      `json:"anonymous"`
+}
+
+// MessagePayload: a chat message arrived
+type MessagePayload struct {
+	ChatID    uuid.UUID `json:"chat_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Preview   string    `json:"preview"`
+}
+
+// MentionPayload: the user was @mentioned in an answer or reply
+type MentionPayload struct {
+	TellID    uuid.UUID `json:"tell_id"`
+	MentionID uuid.UUID `json:"mention_id"`
+}
+
+// LikePayload: someone liked one of the user's answers
+type LikePayload struct {
+	TellID   uuid.UUID `json:"tell_id"`
+	AnswerID uuid.UUID `json:"answer_id"`
+	LikeID   uuid.UUID `json:"like_id"`
+}
+
+func (NewTellPayload) Type() Type  { return NewTell }
+func (AnsweredPayload) Type() Type { return Answered }
+func (NewReplyPayload) Type() Type { return NewReply }
+func (FollowPayload) Type() Type   { return Follow }
+func (MessagePayload) Type() Type  { return Message }
+func (MentionPayload) Type() Type  { return Mention }
+func (LikePayload) Type() Type     { return Like }
+
+func (p NewTellPayload) EventID() uuid.UUID  { return p.TellID }
+func (p AnsweredPayload) EventID() uuid.UUID { return p.AnswerID }
+func (p NewReplyPayload) EventID() uuid.UUID { return p.ReplyID }
+func (p FollowPayload) EventID() uuid.UUID   { return p.FollowID }
+func (p MessagePayload) EventID() uuid.UUID  { return p.MessageID }
+func (p MentionPayload) EventID() uuid.UUID  { return p.MentionID }
+func (p LikePayload) EventID() uuid.UUID     { return p.LikeID }
+
+// Event is something a user should hear about
+type Event struct {
+	UserID  uuid.UUID  // Who is notified
+	ActorID *uuid.UUID // Who caused it; nil keeps them anonymous
+	Payload Payload
+	// Extra fields for the WebSocket frame, for clients that render it directly
+	Realtime fiber.Map
+	// The caller already pushed its own frame regardless of preferences (a
+	// chat message must reach an open chat); Send doesn't push a second one
+	Live bool
+}
+
+// Service stores notifications and delivers them
+type Service struct {
+	DB     *gorm.DB
+	Outbox *mail.Outbox
+}
+
+func NewService(db *gorm.DB, outbox *mail.Outbox) *Service {
+	return &Service{DB: db, Outbox: outbox}
+}
+
+// Preview shortens text for a payload
+func Preview(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= previewLength {
+		return text
+	}
+	return string([]rune(text)[:previewLength-1]) + "…"
+}
+
+// Send delivers the event on the channels the user wants for its type: the
+// notification center, WebSocket and email. Email goes out in the background
+// right away, or waits for the next digest when the user batches email or is
+// in quiet hours. Failures are logged, never returned: a lost notification
+// must not fail the action that caused it.
+func (s *Service) Send(event Event) {
+	channels, settings := s.channelsFor(event.UserID, event.Payload.Type())
+	quiet := InQuietHours(settings, time.Now())
+	if quiet {
+		channels.Push = false
+	}
+
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		log.Printf("❌ Could not encode %s notification: %v", event.Payload.Type(), err)
+		return
+	}
+
+	notification := models.Notification{
+		UserID:  event.UserID,
+		Type:    string(event.Payload.Type()),
+		ActorID: event.ActorID,
+		Payload: string(payload),
+		Data:    payload,
+	}
+	if channels.InApp {
+		if err := s.DB.Create(&notification).Error; err != nil {
+			log.Printf("❌ Could not save %s notification: %v", notification.Type, err)
+			return
+		}
+	}
+
+	if channels.WebSocket && !event.Live {
+		frame := fiber.Map{}
+		for key, value := range event.Realtime {
+			frame[key] = value
+		}
+		frame["type"] = notification.Type
+		if channels.InApp {
+			frame["notification"] = notification
+		}
+		ws.GlobalManager.SendMessage(event.UserID.String(), frame)
+	}
+
+	if channels.Email {
+		if settings.DigestMode != DigestImmediate || quiet {
+			s.queueDigest(event, payload)
+		} else {
+			s.email(event)
+		}
+	}
+}
+
+// email queues the event's email, naming the actor unless they are anonymous
+func (s *Service) email(event Event) {
+	var user models.User
+	if err := s.DB.Select("email, language").First(&user, "id = ?", event.UserID).Error; err != nil || user.Email == "" {
+		return
+	}
+
+	var actorName string
+	if event.ActorID != nil {
+		var actor models.User
+		if err := s.DB.Select("username, full_name").First(&actor, "id = ?", *event.ActorID).Error; err == nil {
+			actorName = actor.FullName
+			if actorName == "" {
+				actorName = actor.Username
+			}
+		}
+	}
+
+	to := utils.Recipient{
+		Email:       user.Email,
+		Language:    user.Language,
+		Unsubscribe: UnsubscribeURL(event.UserID, event.Payload.Type()),
+	}
+
+	var email utils.Email
+	switch event.Payload.Type() {
+	case NewTell:
+		email = utils.NewTellEmail(to)
+	case Answered:
+		email = utils.TellAnsweredEmail(to)
+	case NewReply:
+		email = utils.NewReplyEmail(to)
+	case Follow:
+		email = utils.NewFollowerEmail(to, actorName)
+	case Message:
+		email = utils.NewMessageEmail(to, actorName)
+	case Mention:
+		email = utils.MentionEmail(to, actorName)
+	case Like:
+		email = utils.AnswerLikedEmail(to, actorName)
+	}
+
+	key := fmt.Sprintf("notify:%s:%s:%s", event.Payload.Type(), event.UserID, event.Payload.EventID())
+	if err := s.Outbox.Enqueue(key, email); err != nil {
+		log.Printf("❌ Could not queue %s email: %v", event.Payload.Type(), err)
+	}
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"errors"
+	"time"
+
+	"prswjo/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Channels says where a notification goes
+type Channels struct {
+	InApp     bool `json:"in_app"`    // Kept in the notification center
+	WebSocket bool `json:"websocket"` // Pushed to open tabs
+	Email     bool `json:"email"`
+	Push      bool `json:"push"` // Mobile push; stored for when a push transport exists
+}
+
+// DefaultChannels applies until a user changes a type's channels
+var DefaultChannels = map[Type]Channels{
+	NewTell:  {InApp: true, WebSocket: true, Email: true, Push: true},
+	Answered: {InApp: true, WebSocket: true, Email: true, Push: true},
+	NewReply: {InApp: true, WebSocket: true, Email: true, Push: true},
+	Follow:   {InApp: true, WebSocket: true, Email: true, Push: false},
+	Message:  {InApp: true, WebSocket: true, Email: true, Push: true},
+	Mention:  {InApp: true, WebSocket: true, Email: true, Push: true},
+	Like:     {InApp: true, WebSocket: true, Email: false, Push: false}, // Likes come often; email is opt-in
+}
+
+// DefaultSettings are used for users who never saved notification settings
+func DefaultSettings(userID uuid.UUID) models.NotificationSettings {
+	return models.NotificationSettings{
+		UserID:          userID,
+		Timezone:        "UTC",
+		QuietHoursStart: "22:00",
+		QuietHoursEnd:   "07:00",
+		DigestMode:      DigestImmediate,
+	}
+}
+
+// ValidType reports whether t is a known notification type
+func ValidType(t Type) bool {
+	_, ok := DefaultChannels[t]
+	return ok
+}
+
+// Preferences returns the user's channels for every type, defaults filled in
+func (s *Service) Preferences(userID uuid.UUID) (map[Type]Channels, error) {
+	prefs := make(map[Type]Channels, len(DefaultChannels))
+	for t, channels := range DefaultChannels {
+		prefs[t] = channels
+	}
+
+	var saved []models.NotificationPreference
+	if err := s.DB.Where("user_id = ?", userID).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	for _, pref := range saved {
+		if t := Type(pref.Type); ValidType(t) {
+			prefs[t] = Channels{InApp: pref.InApp, WebSocket: pref.WebSocket, Email: pref.Email, Push: pref.Push}
+		}
+	}
+
+	return prefs, nil
+}
+
+// Settings returns the user's timezone and quiet hours
+func (s *Service) Settings(userID uuid.UUID) (models.NotificationSettings, error) {
+	var settings models.NotificationSettings
+	err := s.DB.First(&settings, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultSettings(userID), nil
+	}
+	return settings, err
+}
+
+// ParseClock reads an HH:MM time of day as minutes after midnight
+func ParseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InQuietHours reports whether now falls in the user's quiet hours, read in
+// their timezone. A window may wrap past midnight (22:00–07:00).
+func InQuietHours(settings models.NotificationSettings, now time.Time) bool {
+	if !settings.QuietHoursEnabled {
+		return false
+	}
+
+	start, err := ParseClock(settings.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(settings.QuietHoursEnd)
+	if err != nil || start == end {
+		return false
+	}
+
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// channelsFor returns the user's channels for a type along with their
+// settings, which decide when email goes out
+func (s *Service) channelsFor(userID uuid.UUID, t Type) (Channels, models.NotificationSettings) {
+	channels := DefaultChannels[t]
+
+	var pref models.NotificationPreference
+	if err := s.DB.First(&pref, "user_id = ? AND type = ?", userID, string(t)).Error; err == nil {
+		channels = Channels{InApp: pref.InApp, WebSocket: pref.WebSocket, Email: pref.Email, Push: pref.Push}
+	}
+
+	settings, err := s.Settings(userID)
+	if err != nil {
+		settings = DefaultSettings(userID)
+	}
+
+	return channels, settings
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"prswjo/models"
+	"prswjo/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AllEmail is the unsubscribe scope of digests, which mix every type
+const AllEmail Type = "all"
+
+var errBadUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// unsubscribeSecret signs unsubscribe tokens. Changing it breaks the links
+// in every email already sent.
+func unsubscribeSecret() []byte {
+	if secret := os.Getenv("UNSUBSCRIBE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// UnsubscribeToken lets whoever holds it turn off email of type t for the
+// user, without logging in. It doesn't expire, so old emails keep working.
+func UnsubscribeToken(userID uuid.UUID, t Type) string {
+	claim := base64.RawURLEncoding.EncodeToString([]byte(userID.String() + ":" + string(t)))
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte(claim))
+	return claim + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseUnsubscribeToken checks the token's signature and returns what it unsubscribes
+func ParseUnsubscribeToken(token string) (uuid.UUID, Type, error) {
+	claim, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, "", errBadUnsubscribeToken
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return uuid.Nil, "", errBadUnsubscribeToken
+	}
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte(claim))
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return uuid.Nil, "", errBadUnsubscribeToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(claim)
+	if err != nil {
+		return uuid.Nil, "", errBadUnsubscribeToken
+	}
+	id, scope, _ := strings.Cut(string(decoded), ":")
+	userID, err := uuid.Parse(id)
+	if err != nil || (scope != string(AllEmail) && !ValidType(Type(scope))) {
+		return uuid.Nil, "", errBadUnsubscribeToken
+	}
+	return userID, Type(scope), nil
+}
+
+// UnsubscribeURL is the one-click unsubscribe link for an email of type t
+func UnsubscribeURL(userID uuid.UUID, t Type) string {
+	return utils.PublicURL() + "/api/unsubscribe?token=" + url.QueryEscape(UnsubscribeToken(userID, t))
+}
+
+// Unsubscribe turns off email for type t, or for every type, keeping the
+// user's other channels as they were
+func (s *Service) Unsubscribe(userID uuid.UUID, t Type) error {
+	prefs, err := s.Preferences(userID)
+	if err != nil {
+		return err
+	}
+
+	types := []Type{t}
+	if t == AllEmail {
+		types = Types
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, t := range types {
+			channels := prefs[t]
+			if err := tx.Save(&models.NotificationPreference{
+				UserID:    userID,
+				Type:      string(t),
+				InApp:     channels.InApp,
+				WebSocket: channels.WebSocket,
+				Email:     false,
+				Push:      channels.Push,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
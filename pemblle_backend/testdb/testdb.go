@@ -0,0 +1,73 @@
+// Package testdb gives tests and benchmarks a migrated Postgres database of
+// their own. They are skipped unless TEST_DATABASE_URL is set.
+package testdb
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"prswjo/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open creates a fresh schema in the TEST_DATABASE_URL database, migrates it
+// and drops it again when tb finishes
+func Open(tb testing.TB) *gorm.DB {
+	tb.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		tb.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		tb.Fatalf("connect to test database: %v", err)
+	}
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		tb.Fatalf("create schema: %v", err)
+	}
+	tb.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// Extensions such as pg_trgm live in public, so it stays on the path
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema+",public")), config)
+	if err != nil {
+		tb.Fatalf("connect to test schema: %v", err)
+	}
+	tb.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := models.Migrate(db); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// withSearchPath sets search_path on a URL or key=value connection string
+func withSearchPath(dsn, path string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		query.Set("search_path", path)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return fmt.Sprintf("%s search_path=%s", dsn, path)
+}
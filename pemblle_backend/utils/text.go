@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHashtagLength caps the number of characters kept in a single hashtag
+const maxHashtagLength = 64
+
+// hashtagPattern matches #tag made of letters, combining marks, digits,
+// underscores and ZWNJ (used inside Kurdish and Persian words), so Arabic and
+// Kurdish tags work. The tag must start the text or follow a non-tag character.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_\x{200C}#])#([\p{L}\p{M}\p{N}_\x{200C}]+)`)
+
+var digitsOnly = regexp.MustCompile(`^[\p{N}_]+$`)
+
+// linkPattern matches links, whose #fragment is not a hashtag
+var linkPattern = regexp.MustCompile(`(?i)(?:[a-z][a-z0-9+.-]*://|www\.)\S+`)
+
+// ExtractHashtags returns the distinct hashtags in text, lowercased and
+// without the leading '#', in order of first appearance
+func ExtractHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	text = linkPattern.ReplaceAllString(text, " ")
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(strings.Trim(match[1], "\u200c"))
+
+		// Skip #123 style tags, they are almost always numbering
+		if tag == "" || digitsOnly.MatchString(tag) || utf8.RuneCountInString(tag) > maxHashtagLength {
+			continue
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// mentionPattern matches @username when it starts the text or follows a
+// character that cannot be part of an email address or another mention
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_.@])@([\p{L}\p{M}\p{N}_.]+)`)
+
+// ExtractMentions returns the distinct @usernames in text, without the '@',
+// in order of first appearance
+func ExtractMentions(text string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// A trailing dot is sentence punctuation, not part of the name
+		username := strings.TrimRight(match[1], ".")
+		key := strings.ToLower(username)
+
+		if username != "" && !seen[key] {
+			seen[key] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+// kurdishLetters are Arabic-script letters used by Kurdish (Sorani) but not Arabic
+const kurdishLetters = "ڕڵۆێەڤ"
+
+// SearchConfig picks the Postgres text search configuration for text:
+// "arabic" for Arabic script, "simple" for Kurdish (Postgres has no Kurdish
+// stemmer and the Arabic one would mangle it) and "english" otherwise
+func SearchConfig(text string) string {
+	arabicScript := false
+	for _, r := range text {
+		if strings.ContainsRune(kurdishLetters, r) {
+			return "simple"
+		}
+		if unicode.Is(unicode.Arabic, r) {
+			arabicScript = true
+		}
+	}
+
+	if arabicScript {
+		return "arabic"
+	}
+	return "english"
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin", "Learning #Go today", []string{"go"}},
+		{"start of text", "#first post", []string{"first"}},
+		{"arabic", "صباح الخير #مرحبا", []string{"مرحبا"}},
+		{"arabic with diacritics", "#عَرَبِي", []string{"عَرَبِي"}},
+		{"kurdish", "سڵاو لە #هەولێر و #کوردستان", []string{"هەولێر", "کوردستان"}},
+		{"zwnj inside kept, trailing dropped", "#می‌خوام #خوش‌", []string{"می‌خوام", "خوش"}},
+		{"trailing punctuation", "Try #golang, #rust. #zig! (#c)", []string{"golang", "rust", "zig", "c"}},
+		{"arabic comma and question mark", "#بغداد، #أربيل؟", []string{"بغداد", "أربيل"}},
+		{"duplicates", "#Go #go #GO #rust #go", []string{"go", "rust"}},
+		{"url fragment", "See https://example.com/page#section", nil},
+		{"url fragment after slash", "Docs at https://example.com/#install and www.example.com/#faq", nil},
+		{"tag next to url", "#news https://example.com/#top", []string{"news"}},
+		{"inside a word", "C#sharp and a#b", nil},
+		{"double hash", "##nope", nil},
+		{"numbering", "Item #1 and #2_3", nil},
+		{"digits after letters", "#web3", []string{"web3"}},
+		{"too long", "#" + strings.Repeat("a", maxHashtagLength+1), nil},
+		{"longest allowed", "#" + strings.Repeat("a", maxHashtagLength), []string{strings.Repeat("a", maxHashtagLength)}},
+		{"no tags", "Nothing to see here", nil},
+	}
+	for _, tt := range tests {
+		if got := ExtractHashtags(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ExtractHashtags(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// FrontendURL is the base URL of the web app, used to build links back to it
+func FrontendURL() string {
+	baseURL := os.Getenv("FRONTEND_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:5173"
+	}
+	return baseURL
+}
+
+// PublicURL is the base URL this API is reached at from the internet. It
+// identifies ActivityPub actors, so it must not change once federating.
+func PublicURL() string {
+	baseURL := os.Getenv("PUBLIC_URL")
+	if baseURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		baseURL = "http://localhost:" + port
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// SiteName is the product name shown in emails, feeds and link previews
+func SiteName() string {
+	name := os.Getenv("SMTP_FROM_NAME")
+	if name == "" {
+		name = "PemBlle"
+	}
+	return name
+}
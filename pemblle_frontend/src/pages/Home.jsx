@@ -10,7 +10,7 @@ function Home() {
     const [loading, setLoading] = useState(true)
     const [loadingMore, setLoadingMore] = useState(false)
     const [hasMore, setHasMore] = useState(true)
-    const [offset, setOffset] = useState(0)
+    const [cursor, setCursor] = useState(null)
     const [expandedReplies, setExpandedReplies] = useState({})
     const limit = 10
     const observer = useRef()
@@ -28,28 +28,29 @@ function Home() {
             }
         })
         if (node) observer.current.observe(node)
-    }, [loadingMore, hasMore])
+    }, [loadingMore, hasMore, cursor])
 
-    const fetchFeed = async (newOffset = 0, append = false) => {
+    const fetchFeed = async (fromCursor = null, append = false) => {
         try {
-            if (newOffset === 0) setLoading(true)
+            if (!fromCursor) setLoading(true)
             else setLoadingMore(true)
 
-            // Get current user ID for personalized feed (prioritize followed users)
-            const userStr = localStorage.getItem('user')
-            const currentUser = userStr ? JSON.parse(userStr) : null
-            const userIdParam = currentUser ? `&user_id=${currentUser.id}` : ''
+            // Send the token for a personalized feed (prioritize followed users)
+            const token = localStorage.getItem('token')
+            const headers = token ? { Authorization: `Bearer ${token}` } : {}
 
-            const res = await axios.get(`/api/public/feed?limit=${limit}&offset=${newOffset}${userIdParam}`)
+            const cursorParam = fromCursor ? `&cursor=${encodeURIComponent(fromCursor)}` : ''
+            const res = await axios.get(`/api/public/feed?limit=${limit}${cursorParam}`, { headers })
+            const items = res.data.items || []
             
             if (append) {
-                setFeed(prev => [...prev, ...res.data])
+                setFeed(prev => [...prev, ...items])
             } else {
-                setFeed(res.data || [])
+                setFeed(items)
             }
             
-            setHasMore(res.data && res.data.length === limit)
-            setOffset(newOffset + (res.data?.length || 0))
+            setHasMore(!!res.data.next_cursor)
+            setCursor(res.data.next_cursor)
         } catch (err) {
             console.error(err)
         } finally {
@@ -60,19 +61,18 @@ function Home() {
 
     const loadMore = () => {
         if (!loadingMore && hasMore) {
-            fetchFeed(offset, true)
+            fetchFeed(cursor, true)
         }
     }
 
     useEffect(() => {
         const fetchData = async () => {
             try {
-                const userStr = localStorage.getItem('user')
-                const currentUser = userStr ? JSON.parse(userStr) : null
-                const excludeParam = currentUser ? `?exclude=${currentUser.id}&limit=5` : '?limit=5'
+                const token = localStorage.getItem('token')
+                const headers = token ? { Authorization: `Bearer ${token}` } : {}
 
-                const usersRes = await axios.get(`/api/users${excludeParam}`)
-                setUsers(usersRes.data)
+                const usersRes = await axios.get('/api/users?limit=5', { headers })
+                setUsers(usersRes.data.items)
             } catch (err) {
                 console.error(err)
             }
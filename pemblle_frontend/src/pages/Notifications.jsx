@@ -26,11 +26,11 @@ function Notifications() {
         try {
             const token = localStorage.getItem('token')
             const [inboxRes, sentRes] = await Promise.all([
-                axios.get('/api/tells', { headers: { Authorization: `Bearer ${token}` } }),
-                axios.get('/api/tells/sent', { headers: { Authorization: `Bearer ${token}` } })
+                axios.get('/api/tells?limit=50', { headers: { Authorization: `Bearer ${token}` } }),
+                axios.get('/api/tells/sent?status=answered&limit=50', { headers: { Authorization: `Bearer ${token}` } })
             ])
-            setTells(inboxRes.data)
-            setSentTells(sentRes.data)
+            setTells(inboxRes.data.items || [])
+            setSentTells(sentRes.data.items || [])
         } catch (err) {
             console.error(err)
         } finally {
@@ -43,19 +43,20 @@ function PublicProfile() {
 
     const fetchUserData = async () => {
         try {
+            const token = localStorage.getItem('token')
+            const headers = token ? { Authorization: `Bearer ${token}` } : {}
             const [userRes, tellsRes] = await Promise.all([
                 axios.get(`/api/users/${username}`),
-                axios.get(`/api/public/tells/${username}`)
+                axios.get(`/api/public/tells/${username}?limit=50`, { headers })
             ])
             setUser(userRes.data)
-            setTells(tellsRes.data || [])
+            setTells(tellsRes.data.items || [])
 
             // Fetch follow counts
             const countsRes = await axios.get(`/api/users/${userRes.data.id}/follow-counts`)
             setFollowCounts(countsRes.data)
 
             // Check follow status if logged in
-            const token = localStorage.getItem('token')
             if (token && !isOwnProfile) {
                 try {
                     const statusRes = await axios.get(`/api/users/${userRes.data.id}/follow-status`, {
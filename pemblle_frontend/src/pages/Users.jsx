@@ -10,7 +10,7 @@ function Users() {
     const [loading, setLoading] = useState(true)
     const [loadingMore, setLoadingMore] = useState(false)
     const [hasMore, setHasMore] = useState(true)
-    const [offset, setOffset] = useState(0)
+    const [cursor, setCursor] = useState(null)
     const limit = 12
     const observer = useRef()
 
@@ -25,25 +25,27 @@ function Users() {
         if (node) observer.current.observe(node)
     }, [loadingMore, hasMore])
 
-    const fetchUsers = async (searchQuery = '', newOffset = 0, append = false) => {
+    const fetchUsers = async (searchQuery = '', fromCursor = null, append = false) => {
         try {
-            if (newOffset === 0) setLoading(true)
+            if (!fromCursor) setLoading(true)
             else setLoadingMore(true)
 
-            const userStr = localStorage.getItem('user')
-            const currentUser = userStr ? JSON.parse(userStr) : null
-            const excludeParam = currentUser ? `&exclude=${currentUser.id}` : ''
+            // The backend leaves the logged-in user out of the results
+            const token = localStorage.getItem('token')
+            const headers = token ? { Authorization: `Bearer ${token}` } : {}
 
-            const res = await axios.get(`/api/users?search=${searchQuery}&limit=${limit}&offset=${newOffset}${excludeParam}`)
+            const params = new URLSearchParams({ search: searchQuery, limit })
+            if (fromCursor) params.set('cursor', fromCursor)
+            const res = await axios.get(`/api/users?${params}`, { headers })
             
             if (append) {
-                setUsers(prev => [...prev, ...res.data])
+                setUsers(prev => [...prev, ...res.data.items])
             } else {
-                setUsers(res.data)
+                setUsers(res.data.items)
             }
             
-            setHasMore(res.data.length === limit)
-            setOffset(newOffset + res.data.length)
+            setHasMore(Boolean(res.data.next_cursor))
+            setCursor(res.data.next_cursor)
         } catch (err) {
             console.error(err)
         } finally {
@@ -54,7 +56,7 @@ function Users() {
 
     const loadMore = () => {
         if (!loadingMore && hasMore) {
-            fetchUsers(search, offset, true)
+            fetchUsers(search, cursor, true)
         }
     }
 
@@ -64,8 +66,8 @@ function Users() {
 
     useEffect(() => {
         const timeoutId = setTimeout(() => {
-            setOffset(0)
-            fetchUsers(search, 0, false)
+            setCursor(null)
+            fetchUsers(search, null, false)
         }, 500)
         return () => clearTimeout(timeoutId)
     }, [search])
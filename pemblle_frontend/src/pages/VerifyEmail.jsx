@@ -7,6 +7,8 @@ function VerifyEmail() {
     const { t } = useTranslation()
     const [searchParams] = useSearchParams()
     const token = searchParams.get('token')
+    // The same link format confirms a new email on an existing account
+    const isEmailChange = searchParams.get('type') === 'email-change'
     const navigate = useNavigate()
     const [status, setStatus] = useState('verifying') // verifying, success, error
     const [countdown, setCountdown] = useState(3)
@@ -27,7 +29,7 @@ function VerifyEmail() {
             console.log('🔍 Attempting verification with token:', token)
 
             try {
-                const res = await fetch(`/api/auth/verify/${token}`)
+                const res = await fetch(isEmailChange ? `/api/auth/email/verify/${token}` : `/api/auth/verify/${token}`)
                 const data = await res.json()
 
                 console.log('📡 Verification response:', { status: res.status, data })
@@ -57,7 +59,7 @@ function VerifyEmail() {
         }
 
         verify()
-    }, [token, navigate])
+    }, [token, isEmailChange, navigate])
 
     return (
         <div className="min-h-[80vh] flex items-center justify-center px-4">
@@ -118,7 +120,7 @@ function VerifyEmail() {
                                 
                                 <div>
                                     <h2 className="text-2xl font-bold text-white mb-2">{t('email_verified')} 🎉</h2>
-                                    <p className="text-dark-400 mb-4">{t('account_activated')}</p>
+                                    <p className="text-dark-400 mb-4">{t(isEmailChange ? 'email_changed' : 'account_activated')}</p>
                                     <p className="text-dark-500 text-sm">{t('redirecting_login')} <span className="text-brand-400 font-bold">{countdown}</span> {t('seconds')}...</p>
                                 </div>
 